@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/pipeline"
+	"github.com/carloszimm/github-mining/internal/processing"
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+func benchCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	sourcesSpecs := fs.String("sources", processing.ARCHIVES_SOURCE,
+		"comma-separated sources to search: archives (retrieved ones), dir:<path>, git:<path>@<ref>, zip:<path> or tgz:<path>")
+	return func(cfg *config.Config) {
+		benchMatchers(cfg, *sourcesSpecs)
+	}
+}
+
+// compares the single-pass operators matcher with the per-operator regexp2 counters
+// over the archives of the configured distribution: both must report the same matches
+func benchMatchers(cfg *config.Config, sourcesSpecs string) {
+	sources, err := processing.ParseSources(sourcesSpecs, cfg.Distribution)
+	util.CheckError(err)
+
+	log.Printf("Benchmarking operators matchers for %s", cfg.Distribution)
+
+	languages, err := processing.LoadLanguages(cfg.FileExtensions)
+	util.CheckError(err)
+	operators, err := types.LoadOperators(cfg.Distribution, "")
+	util.CheckError(err)
+	// offsets are compared as well, not only the totals
+	operators.TrackOccurrences = true
+
+	var (
+		files, bytes, mismatches int
+		matches                  int
+		singlePass, regexps      time.Duration
+	)
+	// interrupting it reports the files benchmarked so far
+	ctx, stop := util.InterruptContext()
+	defer stop()
+	p := pipeline.New(ctx, nil)
+	opts, run := &processing.Options{}, processing.NewRunResults()
+	for msg := range processing.SetupContentPipeline(p, sources, languages, opts, run, cfg.Distribution) {
+		t := msg.Content
+		if t == nil {
+			if done := msg.Done; done != nil && done.Err != nil && ctx.Err() == nil {
+				log.Fatalf("Error reading %s: %v", done.FileName, done.Err)
+			}
+			continue
+		}
+
+		start := time.Now()
+		counts := operators.Count(t)
+		singlePass += time.Since(start)
+
+		start = time.Now()
+		expected := operators.RegexpCount(t)
+		regexps += time.Since(start)
+
+		if !reflect.DeepEqual(counts, expected) {
+			mismatches++
+			log.Printf("Mismatch in %s from %s", t.InnerFileName, t.FileName)
+		}
+		for _, opCount := range counts {
+			matches += opCount.Total
+		}
+		files++
+		bytes += len(t.FileContent)
+	}
+	util.CheckError(p.Wait())
+
+	if ctx.Err() != nil {
+		fmt.Println("Partial benchmark: interrupted before all archives were read")
+	}
+	fmt.Printf("Files: %d, Size: %.2f MB, Operators: %d, Matches: %d\n",
+		files, float64(bytes)/1e6, len(operators.GetOperators()), matches)
+	fmt.Printf("%-12s %14s %12s\n", "Matcher", "Time", "MB/s")
+	for _, bench := range []struct {
+		name string
+		d    time.Duration
+	}{{"single-pass", singlePass}, {"regexp2", regexps}} {
+		fmt.Printf("%-12s %14v %12.2f\n", bench.name, bench.d.Round(time.Millisecond),
+			float64(bytes)/1e6/bench.d.Seconds())
+	}
+	if singlePass > 0 {
+		fmt.Printf("Speedup: %.1fx\n", regexps.Seconds()/singlePass.Seconds())
+	}
+
+	if mismatches > 0 {
+		log.Fatalf("%d file(s) with different results between matchers", mismatches)
+	}
+	log.Println("Both matchers agree on every file")
+}
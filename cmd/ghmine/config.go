@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+func configPrintCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	format := fs.String("format", "json", "format the configuration is printed in: json, yaml or toml")
+	showTokens := fs.Bool("showtokens", false, "indicates if the tokens should be printed instead of masked")
+	return func(cfg *config.Config) {
+		util.CheckError(printConfig(os.Stdout, cfg, *format, *showTokens))
+	}
+}
+
+// masks all but the last characters of the token
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
+
+func printConfig(w io.Writer, cfg *config.Config, format string, showTokens bool) error {
+	printed := *cfg
+	if !showTokens {
+		printed.Tokens = make([]string, len(cfg.Tokens))
+		for i, token := range cfg.Tokens {
+			printed.Tokens[i] = maskToken(token)
+		}
+	}
+
+	switch format {
+	case "json":
+		dat, err := json.MarshalIndent(&printed, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", dat)
+		return err
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&printed); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(&printed)
+	default:
+		return fmt.Errorf("unknown format %q, expected json, yaml or toml", format)
+	}
+}
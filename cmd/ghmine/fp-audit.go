@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/processing"
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// sample drawn and labeled when no file is given
+func defaultAuditSample(cfg *config.Config) string {
+	return filepath.Join(config.FALSE_POSITIVES_PATH,
+		fmt.Sprintf("%s_%s_audit-sample.csv", strings.ToLower(cfg.Distribution), strings.Join(cfg.FileExtensions, "-")))
+}
+
+// reads a list of files (one per line, as the archive's inner path) to restrict the sample to
+func readFileList(path string) map[string]bool {
+	file, err := os.Open(path)
+	util.CheckError(err)
+	defer file.Close()
+
+	files := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			files[name] = true
+		}
+	}
+	util.CheckError(scanner.Err())
+	return files
+}
+
+func splitList(list string) map[string]bool {
+	items := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items[item] = true
+		}
+	}
+	return items
+}
+
+func auditSampleCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	occurrencesPath := fs.String("occurrences", "",
+		"occurrences written by operators -occurrences (defaults to the ones of the configured distribution and extensions)")
+	by := fs.String("by", processing.STRATA_OPERATOR,
+		"strata of the sample: operator (up to -size occurrences of each one) or file (-size files with all of their occurrences)")
+	size := fs.Int("size", 30, "number of occurrences per operator or of files drawn")
+	seed := fs.Int64("seed", 2022, "seed of the random sample")
+	operators := fs.String("operators", "", "comma-separated operators to be sampled (all if empty)")
+	filesList := fs.String("files", "",
+		"file listing the files to be sampled, one per line (e.g. assets/false-positives/collection-like_files.txt)")
+	out := fs.String("out", "",
+		"CSV the sample is written to (defaults to assets/false-positives/<distribution>_<extensions>_audit-sample.csv)")
+	return func(cfg *config.Config) {
+		if *occurrencesPath == "" {
+			*occurrencesPath = filepath.Join(config.OPERATORS_SEARCH_PATH, fmt.Sprintf("%s_%s_occurrences.ndjson",
+				strings.ToLower(cfg.Distribution), strings.Join(cfg.FileExtensions, "-")))
+		}
+		if *out == "" {
+			util.CheckError(util.WriteFolder(config.FALSE_POSITIVES_PATH))
+			*out = defaultAuditSample(cfg)
+		}
+
+		keepOps := splitList(*operators)
+		var keepFiles map[string]bool
+		if *filesList != "" {
+			keepFiles = readFileList(*filesList)
+		}
+		occurrences, err := processing.LoadOccurrences(*occurrencesPath, func(o *types.Occurrence) bool {
+			return (len(keepOps) == 0 || keepOps[o.Operator]) && (keepFiles == nil || keepFiles[o.File])
+		})
+		util.CheckError(err)
+		log.Printf("%d occurrence(s) loaded from %s", len(occurrences), *occurrencesPath)
+
+		entries, err := processing.DrawAuditSample(occurrences, *by, *size, *seed)
+		util.CheckError(err)
+		util.CheckError(processing.WriteAuditSample(*out, entries))
+		log.Printf("Sample of %d occurrence(s) (strata by %s, seed %d) written to %s; label them with %s or %s",
+			len(entries), *by, *seed, *out, processing.TRUE_POSITIVE, processing.FALSE_POSITIVE)
+	}
+}
+
+func auditPrecisionCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	labels := fs.String("labels", "",
+		"labeled sample (CSV) drawn by fp-audit sample (defaults to the one of the configured distribution and extensions)")
+	confidence := fs.Float64("confidence", 0.95, "confidence level of the Wilson intervals")
+	return func(cfg *config.Config) {
+		if *confidence <= 0 || *confidence >= 1 {
+			log.Fatalf("Confidence must be between 0 and 1, got %v", *confidence)
+		}
+		if *labels == "" {
+			*labels = defaultAuditSample(cfg)
+		}
+
+		entries, err := processing.ReadAuditLabels(*labels)
+		util.CheckError(err)
+		report := processing.EstimatePrecision(entries, *confidence)
+		if report.Unlabeled > 0 {
+			log.Printf("%d occurrence(s) not labeled yet are left out", report.Unlabeled)
+		}
+		path := strings.TrimSuffix(*labels, filepath.Ext(*labels)) + "_precision"
+		util.CheckError(report.Write(path))
+		log.Printf("Overall precision: %.4f [%.4f, %.4f] over %d labeled occurrence(s); results at %s.json and .csv",
+			report.Overall.Precision, report.Overall.Lower, report.Overall.Upper, report.Overall.Labeled, path)
+	}
+}
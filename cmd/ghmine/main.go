@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// subcommand of ghmine
+type command struct {
+	name    string
+	summary string
+	// shown by the command's help, after the summary
+	description string
+	// registers the command's flags, returning the function that runs it with the loaded configuration
+	setup func(fs *flag.FlagSet) func(cfg *config.Config)
+}
+
+var commands = []*command{
+	{name: "search", summary: "searches the repositories depending on the distribution",
+		description: "The repositories are written to assets/repo-search/<distribution>_<date>.json, taken by retrieve.",
+		setup:       searchCommand},
+	{name: "retrieve", summary: "downloads the archives of the repositories found by search",
+		description: "The archives are written to assets/repo-retrieval/<distribution>/archives, along with list_of_files.json\n" +
+			"listing the commit of each one.",
+		setup: retrieveCommand},
+	{name: "summary", summary: "counts the repositories depending on each Rx distribution",
+		description: "The table is written to assets/repo-summary.",
+		setup:       summaryCommand},
+	{name: "operators", summary: "counts the operators of the distribution used by the retrieved archives",
+		description: "The results are written to assets/operators-search.",
+		setup:       operatorsCommand},
+	{name: "stats", summary: "summarizes the operators counted by operators",
+		description: "The statistics of each operator (repositories using it, percentiles, Gini coefficient...) are written\n" +
+			"to assets/operators-search/<distributions>_<extensions>_stats.json and .csv; quarantined archives are left out.",
+		setup: statsCommand},
+	{name: "fp-audit sample", summary: "draws a seeded stratified sample of the operators' occurrences to be labeled",
+		description: "Reads the occurrences written by operators -occurrences; the sample is written to\n" +
+			"assets/false-positives/<distribution>_<extensions>_audit-sample.csv, to be labeled by hand.",
+		setup: auditSampleCommand},
+	{name: "fp-audit precision", summary: "estimates the precision per operator and overall from the labeled sample",
+		description: "The estimates, with their Wilson intervals, are written next to the sample (<sample>_precision.json and .csv).",
+		setup:       auditPrecisionCommand},
+	{name: "bench", summary: "checks and benchmarks the operators matcher against the per-operator regular expressions",
+		description: "Fails if both don't report exactly the same matches on every file.",
+		setup:       benchCommand},
+	{name: "rehydrate", summary: "downloads the archives listed in list_of_files.json at their recorded commits",
+		description: "Rebuilds assets/repo-retrieval/<distribution>/archives from the list published with the paper\n" +
+			"(or written by retrieve), so operators can be run over the same files.",
+		setup: rehydrateCommand},
+	{name: "config print", summary: "prints the effective configuration, merged from all of its layers",
+		description: "Tokens are masked unless -showtokens is given.",
+		setup:       configPrintCommand},
+}
+
+// returns the command named by the first arguments (one or two words, e.g. config print)
+// along with its own arguments
+func findCommandIn(args []string) (*command, []string) {
+	for _, c := range commands {
+		words := strings.Fields(c.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == c.name {
+			return c, args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: ghmine <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'ghmine help <command>' (or 'ghmine <command> -h') for the flags of a command.\n")
+}
+
+// flags shared by all commands: where to run from and the layers of the configuration
+type commonFlags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	profile    *string
+	workdir    *string
+	overrides  func(cfg *config.Config) error
+}
+
+func newCommonFlags(name string) *commonFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return &commonFlags{
+		fs: fs,
+		configPath: fs.String("config", os.Getenv(config.ENV_CONFIG),
+			"configuration file, relative to the current directory (defaults to configs/config.json, .yaml, .yml or .toml under -workdir)"),
+		profile: fs.String("profile", "",
+			"profile applied over the configuration file: a name under configs/profiles (e.g. rxjs-paper) or a path"),
+		workdir: fs.String("workdir", os.Getenv(config.ENV_WORKDIR),
+			"root of the repository, with configs and assets, the command runs from (the current directory if empty)"),
+		overrides: config.RegisterFlags(fs),
+	}
+}
+
+// changes to the working directory and loads the configuration: the defaults, the
+// file, the profile, the environment and then the flags
+func (common *commonFlags) load() (*config.Config, error) {
+	path := *common.configPath
+	if path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		path = abs
+	}
+	if *common.workdir != "" {
+		if err := os.Chdir(*common.workdir); err != nil {
+			return nil, fmt.Errorf("changing to the working directory: %w", err)
+		}
+	}
+	if path == "" {
+		path = config.FindFile()
+	}
+
+	layers := &config.Layers{File: path, Profile: *common.profile, Environ: os.Environ(), Flags: common.overrides}
+	return layers.Load()
+}
+
+// parses the command's arguments and runs it, exiting with 2 on invalid arguments
+func (c *command) run(args []string) {
+	own := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	run := c.setup(own)
+	common := newCommonFlags(c.name)
+
+	// a single set parses both, own and common are kept to be listed apart
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	own.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	common.fs.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	fs.Usage = func() { c.help(fs.Output(), own, common.fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg, err := common.load()
+	util.CheckError(err)
+	run(cfg)
+}
+
+func (c *command) help(w io.Writer, own, common *flag.FlagSet) {
+	fmt.Fprintf(w, "usage: ghmine %s [flags]\n\n%s.\n", c.name, strings.ToUpper(c.summary[:1])+c.summary[1:])
+	if c.description != "" {
+		fmt.Fprintf(w, "%s\n", c.description)
+	}
+	hasOwn := false
+	own.VisitAll(func(*flag.Flag) { hasOwn = true })
+	if hasOwn {
+		fmt.Fprintf(w, "\nflags:\n")
+		own.SetOutput(w)
+		own.PrintDefaults()
+	}
+	fmt.Fprintf(w, "\nconfiguration (each key can also be set by %s<KEY>, e.g. %sDISTRIBUTION, and -config,\n"+
+		"-profile and -workdir by %s, %s and %s; the flags take precedence over the environment,\n"+
+		"which takes precedence over the profile, the file and the defaults):\n",
+		config.ENV_PREFIX, config.ENV_PREFIX, config.ENV_CONFIG, config.ENV_PROFILE, config.ENV_WORKDIR)
+	common.SetOutput(w)
+	common.PrintDefaults()
+}
+
+// runs the command given as the first argument
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "help", "-h", "-help", "--help":
+		if len(os.Args) > 2 {
+			if c, _ := findCommandIn(os.Args[2:]); c != nil {
+				c.run([]string{"-h"})
+			}
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.Join(os.Args[2:], " "))
+			usage(os.Stderr)
+			os.Exit(2)
+		}
+		usage(os.Stdout)
+	default:
+		c, args := findCommandIn(os.Args[1:])
+		if c == nil {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+			usage(os.Stderr)
+			os.Exit(2)
+		}
+		c.run(args)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/processing"
+	"github.com/carloszimm/github-mining/internal/progress"
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+	"github.com/golang-module/carbon/v2"
+	"github.com/iancoleman/orderedmap"
+)
+
+// archive left out of the results
+func skipArchive(cfg *config.Config, name string) bool {
+	return cfg.Distribution == "RxJS" && name == "zwacky-game-music-player-v1-38-g3171b55.tar.gz"
+}
+
+// returns the retrieved archives listed in list_of_files.json
+func listedArchives(cfg *config.Config) []string {
+	// loads info about the files in archives(repositories)
+	dat, err := os.ReadFile(filepath.Join(config.REPO_RETRIVAL_PATH, cfg.Distribution, "list_of_files.json"))
+	util.CheckError(err)
+
+	var archivesInfos []types.InfoFile
+	err = json.Unmarshal(dat, &archivesInfos)
+	util.CheckError(err)
+
+	var archives []string
+	for _, val := range archivesInfos {
+		if skipArchive(cfg, val.FileName) {
+			continue
+		}
+		archives = append(archives, val.FileName)
+	}
+	return archives
+}
+
+// initializes a result with an entry per archive
+func createResultMap(archives []string, operatorsList []string) *orderedmap.OrderedMap {
+	result := orderedmap.New()
+	for _, archive := range archives {
+		entry := orderedmap.New()
+		for _, op := range operatorsList {
+			entry.Set(op, 0)
+		}
+		result.Set(archive, entry)
+	}
+	return result
+}
+
+// loads the sources to be searched and the archives the results have an entry for;
+// the retrieved archives are the ones listed in list_of_files.json
+func loadSources(cfg *config.Config, specs string) ([]processing.ArchiveSource, []string) {
+	sources, err := processing.ParseSources(specs, cfg.Distribution)
+	util.CheckError(err)
+
+	var archives []string
+	for _, spec := range strings.Split(specs, ",") {
+		if strings.TrimSpace(spec) == processing.ARCHIVES_SOURCE {
+			archives = listedArchives(cfg)
+			break
+		}
+	}
+	listed := make(map[string]bool, len(archives))
+	for _, archive := range archives {
+		listed[archive] = true
+	}
+
+	var selected []processing.ArchiveSource
+	for _, source := range sources {
+		if skipArchive(cfg, source.Name()) {
+			continue
+		}
+		if !listed[source.Name()] {
+			listed[source.Name()] = true
+			archives = append(archives, source.Name())
+		} else if !strings.HasSuffix(source.Name(), ".tar.gz") {
+			log.Fatalf("More than one source named %s", source.Name())
+		}
+		selected = append(selected, source)
+	}
+	return selected, archives
+}
+
+// parses the comma-separated distributions to be searched
+func parseDistributions(cfg *config.Config, list string) []string {
+	var dists []string
+	seen := make(map[string]bool)
+	for _, dist := range strings.Split(list, ",") {
+		dist = strings.TrimSpace(dist)
+		if dist == "" || seen[strings.ToLower(dist)] {
+			continue
+		}
+		seen[strings.ToLower(dist)] = true
+		dists = append(dists, dist)
+	}
+	if len(dists) == 0 {
+		dists = []string{cfg.Distribution}
+	}
+	return dists
+}
+
+type CatalogMeta struct {
+	File       string   `json:"file"`
+	Version    string   `json:"version"`
+	Operators  int      `json:"operators"`
+	Deprecated []string `json:"deprecated,omitempty"`
+}
+
+// archives covered by the results written after an interruption
+type PartialMeta struct {
+	Finished int `json:"finished"`
+	// archives not searched yet, including the interrupted ones
+	Pending     int      `json:"pending"`
+	Interrupted []string `json:"interrupted,omitempty"`
+}
+
+// when several distributions are searched, distribution is the one whose archives were
+// retrieved and catalogs has the catalog of each distribution searched
+type Meta struct {
+	Distribution   string                 `json:"distribution"`
+	Distributions  []string               `json:"distributions,omitempty"`
+	FileExtensions []string               `json:"fileExtensions"`
+	Date           string                 `json:"date"`
+	Catalog        *CatalogMeta           `json:"catalog,omitempty"`
+	Catalogs       map[string]CatalogMeta `json:"catalogs,omitempty"`
+	// set when the search was interrupted
+	Partial *PartialMeta `json:"partial,omitempty"`
+}
+
+func createCatalogMeta(operators *types.Operators) CatalogMeta {
+	return CatalogMeta{
+		File:       operators.Catalog.File,
+		Version:    operators.Catalog.Version,
+		Operators:  len(operators.GetOperators()),
+		Deprecated: operators.Catalog.Deprecated(),
+	}
+}
+
+func createMeta(cfg *config.Config, operators []*types.Operators) *Meta {
+	meta := &Meta{
+		Distribution:   cfg.Distribution,
+		FileExtensions: cfg.FileExtensions,
+		Date:           carbon.Now().ToDateTimeString(),
+	}
+	if len(operators) == 1 {
+		catalog := createCatalogMeta(operators[0])
+		meta.Catalog = &catalog
+		return meta
+	}
+	meta.Catalogs = make(map[string]CatalogMeta)
+	for _, ops := range operators {
+		meta.Distributions = append(meta.Distributions, ops.Dist)
+		meta.Catalogs[ops.Dist] = createCatalogMeta(ops)
+	}
+	return meta
+}
+
+type operatorsFlags struct {
+	checkFalsePositives, occurrences, fresh, cooccurrence *bool
+	sourcesSpecs, catalogFile, distributions              *string
+	progress                                              progress.Options
+	// options of the pipeline set by flags
+	opts processing.Options
+}
+
+func operatorsCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	var flags operatorsFlags
+	flags.checkFalsePositives = fs.Bool("checkfalsepositives", false,
+		"indicates if files importing confounding libraries (e.g. Java collection-like libs) along with the distribution should be reported")
+	flags.occurrences = fs.Bool("occurrences", false,
+		"indicates if every operator match should also be written (NDJSON) with its file, line, column and snippet")
+	fs.BoolVar(&flags.opts.KeepExcludedFiles, "keepexcluded", false,
+		"indicates if vendored, generated, minified and bundled Rx files should be searched as well")
+	fs.BoolVar(&flags.opts.ExtractChains, "chains", false,
+		"indicates if chains of operators should be extracted and their bigrams and trigrams counted")
+	flags.cooccurrence = fs.Bool("cooccurrence", false,
+		"indicates if operators co-occurrence matrices (per file and per repository) should be built")
+	flags.sourcesSpecs = fs.String("sources", processing.ARCHIVES_SOURCE,
+		"comma-separated sources to search: archives (retrieved ones), dir:<path>, git:<path>@<ref>, zip:<path> or tgz:<path>")
+	flags.fresh = fs.Bool("fresh", false,
+		"indicates if the checkpoint of previous runs should be discarded instead of resumed")
+	flags.progress.RegisterFlags(fs)
+	flags.catalogFile = fs.String("catalog", "",
+		"name of the operators catalog under assets/operators (defaults to the first one named after the distribution)")
+	flags.distributions = fs.String("distributions", "",
+		"comma-separated distributions to be searched in the same pass over the archives (defaults to the configured one)")
+	return func(cfg *config.Config) {
+		searchOperators(cfg, &flags)
+	}
+}
+
+func searchOperators(cfg *config.Config, flags *operatorsFlags) {
+	dists := parseDistributions(cfg, *flags.distributions)
+	log.Printf("Starting searching for %s operators", strings.Join(dists, ", "))
+	if len(dists) > 1 && *flags.catalogFile != "" {
+		log.Fatal("A catalog can only be given when a single distribution is searched")
+	}
+
+	util.CheckError(util.WriteFolder(config.OPERATORS_SEARCH_PATH))
+	exts := strings.Join(cfg.FileExtensions, "-")
+	// name of the files of each distribution and of the ones shared by all of them
+	distFileName := func(dist string) string {
+		return filepath.Join(config.OPERATORS_SEARCH_PATH, fmt.Sprintf("%s_%s", strings.ToLower(dist), exts))
+	}
+	fileName := distFileName(strings.Join(dists, "-"))
+	if *flags.occurrences {
+		flags.opts.OccurrencesPath = fileName + "_occurrences.ndjson"
+	}
+
+	// loads the languages related to the analyzed distribution
+	languages, err := processing.LoadLanguages(cfg.FileExtensions)
+	util.CheckError(err)
+
+	// loads the sources
+	sources, archives := loadSources(cfg, *flags.sourcesSpecs)
+
+	// loads operators and initializes the results of each distribution
+	run := processing.NewRunResults()
+	operators := make([]*types.Operators, 0, len(dists))
+	for _, dist := range dists {
+		ops, err := types.LoadOperators(dist, *flags.catalogFile)
+		util.CheckError(err)
+		operators = append(operators, ops)
+		results := processing.NewResults(createResultMap(archives, ops.GetOperators()))
+		if flags.opts.ExtractChains {
+			results.NGrams = processing.NewNGrams()
+		}
+		if *flags.cooccurrence {
+			results.CoOccurrences = processing.NewCoOccurrences(ops.GetOperators())
+		}
+		run.Add(dist, results)
+	}
+
+	if *flags.checkFalsePositives {
+		coImports, err := processing.NewCoImportReport(cfg, dists)
+		util.CheckError(err)
+		run.CoImports = coImports
+	}
+
+	// archives finished by previous runs are restored from the checkpoint and skipped
+	checkpoint, err := processing.OpenCheckpoint(fileName+"_checkpoint.ndjson", *flags.fresh)
+	util.CheckError(err)
+	util.CheckError(checkpoint.Restore(run))
+	run.Checkpoint = checkpoint
+	var pending []processing.ArchiveSource
+	for _, source := range sources {
+		if !checkpoint.Done(source.Name()) {
+			pending = append(pending, source)
+		}
+	}
+	if len(pending) < len(sources) {
+		log.Printf("Resuming: %d archive(s) restored from the checkpoint, %d to be searched",
+			len(sources)-len(pending), len(pending))
+	}
+	sources = pending
+
+	// an interruption stops the search, writing the results of the finished archives
+	ctx, stop := util.InterruptContext()
+	defer stop()
+	flags.opts.Progress = progress.NewTracker("operators", "archives")
+	flags.opts.Progress.SetTotal(len(sources))
+	stopProgress := flags.opts.Progress.Start(&flags.progress)
+	resultChannel := processing.SetupOpsPipeline(ctx, sources, languages, operators, &flags.opts, run)
+
+	result := <-resultChannel
+	stopProgress()
+	util.CheckError(result.Err)
+	util.CheckError(checkpoint.Close())
+
+	meta := createMeta(cfg, operators)
+	if ctx.Err() != nil {
+		// only the archives finished, by this run or previous ones, are written
+		total := len(run.Archives())
+		run.Retain(checkpoint.Done)
+		meta.Partial = &PartialMeta{Finished: len(run.Archives()), Pending: total - len(run.Archives()),
+			Interrupted: run.Interrupted}
+		fileName += "_partial"
+		log.Printf("Search interrupted with %d of %d archive(s) finished; running it again resumes from the checkpoint",
+			meta.Partial.Finished, total)
+	} else {
+		log.Println("Search for operators finished!")
+	}
+	log.Printf("Number of processed files: %d. Writing Results...\n", result.Files)
+	// metadata about how the result was produced
+	util.CheckError(util.WritePrettyJSON(fileName+"_meta", meta))
+	if len(dists) == 1 {
+		util.CheckError(writeResults(fileName, run.Distributions[dists[0]]))
+	} else {
+		// results keyed by distribution
+		counts, countsByClass, countsByLanguage := orderedmap.New(), orderedmap.New(), orderedmap.New()
+		for _, dist := range dists {
+			counts.Set(dist, run.Distributions[dist].Counts)
+			countsByClass.Set(dist, run.Distributions[dist].CountsByClass)
+			countsByLanguage.Set(dist, run.Distributions[dist].CountsByLanguage)
+		}
+		util.CheckError(util.WriteJSON(fileName, counts))
+		util.CheckError(util.WriteJSON(fileName+"_by-class", countsByClass))
+		util.CheckError(util.WriteJSON(fileName+"_by-language", countsByLanguage))
+		for _, dist := range dists {
+			util.CheckError(writeAuxResults(fileName+"_"+strings.ToLower(dist), run.Distributions[dist]))
+		}
+		// distributions used together in the archives
+		util.CheckError(util.WritePrettyJSON(fileName+"_mixed", run.MixedUsage()))
+	}
+	if len(run.Quarantined) > 0 {
+		util.CheckError(util.WritePrettyJSON(fileName+"_quarantined", run.Quarantined))
+		log.Printf("%d archive(s) quarantined due to errors", len(run.Quarantined))
+	}
+	if run.CoImports != nil {
+		// files worth inspecting for false positives
+		util.CheckError(run.CoImports.Write(fileName + "_co-imports"))
+		log.Printf("Files importing confounding libraries: %v", run.CoImports.Totals())
+	}
+	// Rx versions detected in each archive
+	util.CheckError(run.Versions.Write(fileName + "_versions"))
+	if !flags.opts.KeepExcludedFiles {
+		util.CheckError(run.Exclusions.Write(fileName + "_excluded"))
+		log.Printf("Excluded files per category: %v", run.Exclusions.Totals)
+	}
+	if *flags.occurrences {
+		log.Printf("Occurrences available at: %s", flags.opts.OccurrencesPath)
+	}
+	log.Println("Done!")
+}
+
+// writes the results of a single distribution
+func writeResults(fileName string, results *processing.Results) error {
+	if err := util.WriteJSON(fileName, results.Counts); err != nil {
+		return err
+	}
+	// same counts split by test, production and sample files
+	if err := util.WriteJSON(fileName+"_by-class", results.CountsByClass); err != nil {
+		return err
+	}
+	// and by the language detected for the files
+	if err := util.WriteJSON(fileName+"_by-language", results.CountsByLanguage); err != nil {
+		return err
+	}
+	return writeAuxResults(fileName, results)
+}
+
+// writes the n-grams and co-occurrences, when they are built
+func writeAuxResults(fileName string, results *processing.Results) error {
+	if results.NGrams != nil {
+		if err := util.WritePrettyJSON(fileName+"_ngrams", results.NGrams.Result()); err != nil {
+			return err
+		}
+	}
+	if results.CoOccurrences != nil {
+		return results.CoOccurrences.Write(fileName)
+	}
+	return nil
+}
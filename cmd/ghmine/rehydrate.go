@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/carloszimm/github-mining/internal/auth"
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/progress"
+	"github.com/carloszimm/github-mining/internal/tokenpool"
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+	"github.com/google/go-github/v41/github"
+)
+
+// attempts to download an archive before giving up on it; client errors, such as the
+// ones of deleted repositories, aren't retried
+const REHYDRATE_ATTEMPTS = 3
+
+// progress of the downloads and API quota of each token
+var rehydrateTracker = progress.NewTracker("rehydrate", "archives")
+
+func rehydrateCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	list := fs.String("list", "",
+		"list of the archives to be downloaded (defaults to the distribution's list_of_files.json under assets/repo-retrieval)")
+	force := fs.Bool("force", false, "indicates if the archives already downloaded should be downloaded again")
+	var progressOpts progress.Options
+	progressOpts.RegisterFlags(fs)
+	return func(cfg *config.Config) {
+		rehydrateArchives(cfg, *list, *force, &progressOpts)
+	}
+}
+
+// downloads the archive to archivesPath, through a temporary file so an interrupted
+// download doesn't leave a truncated archive behind
+func downloadArchive(ctx context.Context, pool *tokenpool.Pool, info *types.Info, archivesPath string) error {
+	var resp *github.Response
+	err := pool.Do(ctx, tokenpool.CORE, func(client *github.Client) (*github.Response, error) {
+		req, err := client.NewRequest("GET", info.ArchiveUrl, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = client.BareDo(ctx, req)
+		return resp, err
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(archivesPath, info.FileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	size, err := io.Copy(tmp, resp.Body)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if info.FileSize > 0 && int(size) != info.FileSize {
+		// the tarballs are generated on demand, so the same commit may be compressed differently
+		log.Printf("%s has %d bytes, %d listed", info.FileName, size, info.FileSize)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(archivesPath, info.FileName))
+}
+
+func rehydrateWorker(ctx context.Context, wg *sync.WaitGroup, pool *tokenpool.Pool, archivesPath string,
+	infos <-chan *types.Info, failures chan<- string) {
+	defer wg.Done()
+	for info := range infos {
+		var err error
+		for attempt := 0; attempt < REHYDRATE_ATTEMPTS; attempt++ {
+			if err = downloadArchive(ctx, pool, info, archivesPath); err == nil || ctx.Err() != nil {
+				break
+			}
+			if tokenpool.Rejected(err) || attempt+1 == REHYDRATE_ATTEMPTS || tokenpool.Backoff(ctx, attempt+1) != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			// interrupted, the archive is left to the next run
+			return
+		}
+		if err != nil {
+			log.Printf("Could not download %s: %v", info.FileName, err)
+			failures <- info.FileName
+		}
+		rehydrateTracker.AddDone(1)
+	}
+}
+
+func rehydrateArchives(cfg *config.Config, listPath string, force bool, progressOpts *progress.Options) {
+	if listPath == "" {
+		listPath = filepath.Join(config.REPO_RETRIVAL_PATH, cfg.Distribution, "list_of_files.json")
+	}
+	dat, err := os.ReadFile(listPath)
+	util.CheckError(err)
+	var infos []*types.Info
+	if err := json.Unmarshal(dat, &infos); err != nil {
+		log.Fatalf("Invalid list of archives %s: %v", listPath, err)
+	}
+
+	archivesPath := filepath.Join(filepath.Dir(listPath), config.ARCHIVES_FOLDER)
+	util.CheckError(util.WriteFolder(archivesPath))
+	// archives already downloaded are kept, so an interrupted run can be resumed
+	var pending []*types.Info
+	for _, info := range infos {
+		if _, err := os.Stat(filepath.Join(archivesPath, info.FileName)); force || err != nil {
+			pending = append(pending, info)
+		}
+	}
+	log.Printf("Downloading %d of %d archive(s) listed in %s", len(pending), len(infos), listPath)
+	if len(pending) == 0 {
+		return
+	}
+
+	// an interruption stops the downloads, the ones finished being kept
+	ctx, stop := util.InterruptContext()
+	defer stop()
+
+	credentials, err := auth.Load(cfg)
+	util.CheckError(err)
+	pool := tokenpool.New(credentials, true)
+	util.CheckError(pool.Validate(ctx, cfg.RequiredScopes))
+	pool.OnResponse = rehydrateTracker.UpdateQuota
+
+	jobs := make(chan *types.Info)
+	failures := make(chan string, len(pending))
+	rehydrateTracker.SetTotal(len(pending))
+	stopProgress := rehydrateTracker.Start(progressOpts)
+
+	var wg sync.WaitGroup
+	wg.Add(pool.Len())
+	for i := 0; i < pool.Len(); i++ {
+		go rehydrateWorker(ctx, &wg, pool, archivesPath, jobs, failures)
+	}
+	for _, info := range pending {
+		select {
+		case jobs <- info:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	stopProgress()
+	close(failures)
+
+	var failed []string
+	for fileName := range failures {
+		failed = append(failed, fileName)
+	}
+	if ctx.Err() != nil {
+		log.Println("Interrupted: running it again downloads the remaining archives")
+	}
+	if len(failed) > 0 {
+		log.Fatalf("%d archive(s) could not be downloaded: %v", len(failed), failed)
+	}
+	log.Printf("Archives available at: %s", archivesPath)
+}
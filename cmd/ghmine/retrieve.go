@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/auth"
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/pipeline"
+	"github.com/carloszimm/github-mining/internal/processing"
+	"github.com/carloszimm/github-mining/internal/progress"
+	"github.com/carloszimm/github-mining/internal/tokenpool"
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+	"github.com/golang-module/carbon/v2"
+	"github.com/google/go-github/v41/github"
+)
+
+var RX_USERS = map[string]struct{}{
+	"ReactiveX":           {},
+	"Reactive-Extensions": {},
+	"dotnet":              {},
+	"neuecc":              {},
+	"bjornbytes":          {},
+	"alfert":              {},
+	"kzaher":              {},
+}
+
+// progress of the downloads and API quota of each token
+var retrievalTracker = progress.NewTracker("retrieve", "repositories")
+
+type retrieval struct {
+	cfg *config.Config
+	// tokens shared by the download and branch workers, plus the unauthenticated client
+	pool *tokenpool.Pool
+}
+
+type Summary struct {
+	StartTime      string
+	EndTime        string
+	TotalRepos     int
+	ProcessedRepos int
+	// set when the retrieval was interrupted
+	Partial         bool
+	DownloadedRepos int
+}
+
+// adds to p the stage downloading the repositories' archives, whose infos are sent to
+// the returned channel; when p is cancelled, the archives not downloaded yet are left out
+func (r *retrieval) setup(p *pipeline.Pipeline, repos []github.Repository) <-chan *types.Info {
+	path := filepath.Join(config.REPO_RETRIVAL_PATH, r.cfg.Distribution)
+	util.CheckError(util.RemoveAllFolders(path))
+	archivesPath := filepath.Join(path, config.ARCHIVES_FOLDER)
+	util.CheckError(util.WriteFolder(archivesPath))
+
+	// a worker per client of the pool (credentials plus the unauthenticated one)
+	return pipeline.Stage(p, "downloads", r.pool.Len(), pipeline.Source(p, repos),
+		func(ctx context.Context, repo github.Repository, emit func(*types.Info)) error {
+			return r.download(ctx, archivesPath, repo, emit)
+		})
+}
+
+// downloads the archive of a repository, retrying it with a backoff until it succeeds unless
+// GitHub rejects the request (e.g. for a repository deleted since the search)
+func (r *retrieval) download(ctx context.Context, archivesPath string, repo github.Repository,
+	emit func(*types.Info)) error {
+	for attempt := 1; ctx.Err() == nil; attempt++ {
+		log.Printf("Downloading %s\n", repo.GetFullName())
+
+		var resp *github.Response
+		// rate limits are waited for by the pool
+		err := r.pool.Do(ctx, tokenpool.CORE, func(client *github.Client) (*github.Response, error) {
+			req, err := client.NewRequest("GET",
+				fmt.Sprintf("repos/%s/%s/tarball", repo.GetOwner().GetLogin(), repo.GetName()), nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err = client.BareDo(ctx, req)
+			return resp, err
+		})
+		if ctx.Err() != nil {
+			// interrupted, the archive is left out
+			return nil
+		}
+		if err != nil {
+			log.Printf("Could not download %s: %v", repo.GetFullName(), err)
+			if tokenpool.Rejected(err) || tokenpool.Backoff(ctx, attempt) != nil {
+				return nil
+			}
+			continue
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			// e.g. a truncated tarball: retried as the failed requests, only the
+			// write errors below stop the retrieval
+			log.Printf("Could not download %s: %v", repo.GetFullName(), err)
+			if tokenpool.Backoff(ctx, attempt) != nil {
+				return nil
+			}
+			continue
+		}
+
+		fileName := strings.Split(resp.Header["Content-Disposition"][0], "=")[1]
+		if err := os.WriteFile(filepath.Join(archivesPath, fileName), body, 0644); err != nil {
+			return err
+		}
+
+		// detects the Rx versions while the archive is still in memory
+		rxVersions, err := processing.DetectArchiveVersions(bytes.NewReader(body), r.cfg.Distribution)
+		if err != nil {
+			log.Printf("Could not detect the Rx versions of %s: %v", fileName, err)
+		}
+
+		emit(&types.Info{Owner: repo.GetOwner().GetLogin(), RepositoryName: repo.GetName(),
+			RepositoryFullName: repo.GetFullName(), Branch: repo.GetDefaultBranch(),
+			FileName: fileName, FileSize: len(body), ArchiveUrl: repo.GetArchiveURL(),
+			RxVersions: rxVersions})
+		retrievalTracker.AddDone(1)
+		return nil
+	}
+	return nil
+}
+
+// emits the info of the archive with the URL of the commit at the head of its branch,
+// retrying it with a backoff until it succeeds or the context is cancelled; if GitHub
+// rejects the request, the URL points to the branch
+func (r *retrieval) retrieveBranchInfo(ctx context.Context, i *types.Info, emit func(types.Info)) error {
+	for attempt := 1; ctx.Err() == nil; attempt++ {
+		var branchInfo *github.Branch
+		// rate limits are waited for by the pool
+		err := r.pool.Do(ctx, tokenpool.CORE, func(client *github.Client) (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			branchInfo, resp, err = client.Repositories.GetBranch(ctx, i.Owner, i.RepositoryName, i.Branch, true)
+			return resp, err
+		})
+		if ctx.Err() != nil {
+			// interrupted
+			return nil
+		}
+		if err != nil {
+			log.Printf("Could not retrieve the branch of %s: %v", i.RepositoryFullName, err)
+			if tokenpool.Rejected(err) {
+				info := *i
+				info.ArchiveUrl = tarballUrl(i.ArchiveUrl, i.Branch)
+				emit(info)
+				return nil
+			}
+			if tokenpool.Backoff(ctx, attempt) != nil {
+				return nil
+			}
+			continue
+		}
+		info := *i
+		info.ArchiveUrl = tarballUrl(i.ArchiveUrl, branchInfo.GetCommit().GetSHA())
+		emit(info)
+		return nil
+	}
+	return nil
+}
+
+// fills the archive URL template in with the tarball of the given ref
+func tarballUrl(archiveUrl, ref string) string {
+	return strings.Replace(strings.Replace(archiveUrl, "{archive_format}", "tarball", 1), "{/ref}", "/"+ref, 1)
+}
+
+// writes the infos of the archives with the URL of the commit downloaded; when interrupted,
+// the list is written as partial, archives whose commit wasn't resolved pointing to their branch
+func (r *retrieval) processFileInfos(ctx context.Context, fileInfos []*types.Info) {
+	fileName := "list_of_files"
+
+	p := pipeline.New(ctx, nil)
+	results := pipeline.Stage(p, "branches", r.pool.Len(), pipeline.Source(p, fileInfos), r.retrieveBranchInfo)
+
+	var newFileInfos []types.Info
+	resolved := make(map[string]bool)
+	for info := range results {
+		newFileInfos = append(newFileInfos, info)
+		resolved[info.FileName] = true
+	}
+	util.CheckError(p.Wait())
+	if ctx.Err() != nil {
+		for _, info := range fileInfos {
+			if !resolved[info.FileName] {
+				unresolved := *info
+				unresolved.ArchiveUrl = tarballUrl(info.ArchiveUrl, info.Branch)
+				newFileInfos = append(newFileInfos, unresolved)
+			}
+		}
+		// not taken by operator-search
+		fileName += "_partial"
+	}
+
+	util.CheckError(util.WriteJSON(filepath.Join(config.REPO_RETRIVAL_PATH, r.cfg.Distribution, fileName), newFileInfos))
+}
+
+func writeSummary(path string, summ *Summary) {
+	template := "Start Time: %v\nEnd Time: %v\nTotal of Repositories: %v\n"
+	template += "Repositories Processed: %v"
+	text := fmt.Sprintf(template, summ.StartTime, summ.EndTime, summ.TotalRepos, summ.ProcessedRepos)
+
+	fileName := fmt.Sprintf("summary_%s.txt", util.NowDateTimeFormatted())
+	if summ.Partial {
+		text += fmt.Sprintf("\nPartial: interrupted with %d of %d repositories downloaded",
+			summ.DownloadedRepos, summ.ProcessedRepos)
+		fileName = fmt.Sprintf("summary_%s_partial.txt", util.NowDateTimeFormatted())
+	}
+
+	err := os.WriteFile(filepath.Join(path, fileName), []byte(text), 0644)
+	util.CheckError(err)
+}
+
+func retrieveCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	var progressOpts progress.Options
+	progressOpts.RegisterFlags(fs)
+	return func(cfg *config.Config) {
+		retrieveRepositories(cfg, &progressOpts)
+	}
+}
+
+func retrieveRepositories(cfg *config.Config, progressOpts *progress.Options) {
+	// an interruption stops the downloads, writing the infos of the archives downloaded so far
+	ctx, stop := util.InterruptContext()
+	defer stop()
+
+	credentials, err := auth.Load(cfg)
+	util.CheckError(err)
+	r := &retrieval{cfg: cfg, pool: tokenpool.New(credentials, true)}
+	util.CheckError(r.pool.Validate(ctx, cfg.RequiredScopes))
+	r.pool.OnResponse = retrievalTracker.UpdateQuota
+
+	c, err := os.ReadDir(REPO_SEARCH_PATH)
+	util.CheckError(err)
+
+	summ := Summary{
+		StartTime: carbon.Now().ToDayDateTimeString()}
+
+	var repos []github.Repository
+	for _, entry := range c {
+		// loops through folder entries and stop as soon as the entry hits the distribution being looked for
+		// partial results of interrupted searches are skipped
+		if !entry.IsDir() && strings.Split(entry.Name(), "_")[0] == cfg.Distribution &&
+			!strings.HasSuffix(entry.Name(), "_partial.json") {
+			dat, err := os.ReadFile(filepath.Join(REPO_SEARCH_PATH, entry.Name()))
+			util.CheckError(err)
+
+			err = json.Unmarshal(dat, &repos)
+			util.CheckError(err)
+
+			break
+		}
+	}
+
+	if len(repos) > 0 {
+		var filteredRepos []github.Repository
+		for _, repo := range repos {
+			if _, ok := RX_USERS[repo.GetOwner().GetLogin()]; !ok {
+				filteredRepos = append(filteredRepos, repo)
+			}
+		}
+		summ.TotalRepos, summ.ProcessedRepos = len(repos), len(filteredRepos)
+
+		retrievalTracker.SetTotal(len(filteredRepos))
+		stopProgress := retrievalTracker.Start(progressOpts)
+		p := pipeline.New(ctx, retrievalTracker)
+		out := r.setup(p, filteredRepos)
+
+		// writes infos about the archives as JSON to avoid uploading all downloaded repos
+		var filesInfos []*types.Info
+		for info := range out {
+			filesInfos = append(filesInfos, info)
+		}
+		stopProgress()
+		util.CheckError(p.Wait())
+		r.processFileInfos(ctx, filesInfos)
+		// writes summary
+		summ.Partial, summ.DownloadedRepos = ctx.Err() != nil, len(filesInfos)
+		summ.EndTime = carbon.Now().ToDayDateTimeString()
+		path := filepath.Join(config.REPO_RETRIVAL_PATH, cfg.Distribution)
+		writeSummary(path, &summ)
+
+		log.Printf("Processed %d from %d repositories\n", summ.ProcessedRepos, summ.TotalRepos)
+		log.Printf("Results available at: %s", path)
+	} else {
+		log.Println("No repositories to be processed")
+	}
+}
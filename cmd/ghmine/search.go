@@ -2,17 +2,20 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
+	"github.com/carloszimm/github-mining/internal/auth"
 	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/progress"
+	"github.com/carloszimm/github-mining/internal/tokenpool"
 	"github.com/carloszimm/github-mining/internal/util"
 	"github.com/golang-module/carbon/v2"
 	"github.com/google/go-github/v41/github"
-	"golang.org/x/oauth2"
 )
 
 type QueryOpts struct {
@@ -28,7 +31,15 @@ type QueryResult struct {
 	*QueryOpts
 }
 
+// suffix of the results written when the search is interrupted
+const PARTIAL_SUFFIX = "_partial"
+
+// repositories found by search, taken by retrieve
+var REPO_SEARCH_PATH = filepath.Join("assets", "repo-search")
+
+// guarded by a mutex, as it's read by the goroutine sending the queries
 type UniqueResults struct {
+	mu      sync.Mutex
 	Results map[int64]*github.Repository
 }
 
@@ -39,6 +50,8 @@ func NewUniqueResults() *UniqueResults {
 }
 
 func (ur *UniqueResults) AddAll(repos []*github.Repository) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
 	for _, repo := range repos {
 		if _, ok := ur.Results[*repo.ID]; !ok {
 			ur.Results[*repo.ID] = repo
@@ -47,10 +60,14 @@ func (ur *UniqueResults) AddAll(repos []*github.Repository) {
 }
 
 func (ur *UniqueResults) Length() int {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
 	return len(ur.Results)
 }
 
 func (ur *UniqueResults) AsArray() []*github.Repository {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
 	var repos []*github.Repository
 	for _, repo := range ur.Results {
 		repos = append(repos, repo)
@@ -249,30 +266,19 @@ func handleTimeIntervalsSearch(jobs chan *QueryOpts, results chan *QueryResult,
 
 }
 
-func main() {
-	cfg := *config.GetConfigInstance()
-
-	jobs := make(chan *QueryOpts, 3*len(cfg.Tokens))
-	results := make(chan *QueryResult, 3*len(cfg.Tokens))
-
-	// create workers according to GitHub tokens provided under config
-	for w := 0; w < len(cfg.Tokens); w++ {
-		go worker(w, cfg.Tokens[w], jobs, results)
-	}
-
-	log.Printf("Starting search for %s\n", cfg.Distribution)
-
+// runs the queries of the distribution's search, adding the repositories found to uniqueResults
+func search(cfg *config.Config, jobs chan *QueryOpts, results chan *QueryResult,
+	uniqueResults *UniqueResults) *QueryResult {
 	jobs <- &QueryOpts{
 		Query: fmt.Sprintf("%s stars:>=%d", cfg.Distribution, cfg.MinStars),
 		Sort:  "stars",
 		Order: "desc",
 	}
 	result := <-results
+	uniqueResults.AddAll(result.Repositories)
 
 	if result.Total > 1000 {
 		var excedingQueries []string
-		uniqueResults := NewUniqueResults()
-		uniqueResults.AddAll(result.Repositories)
 
 		intervals := constructStarInterval(cfg.MinStars,
 			result.Repositories[0].GetStargazersCount(), cfg.IncreaseFactor)
@@ -301,22 +307,85 @@ func main() {
 
 		result.Repositories = uniqueResults.AsArray()
 	}
-	log.Printf("Total results: %d, Results retrieved: %d\n", result.Total, len(result.Repositories))
-	log.Println("Writing results...")
-	util.WriteJSON(filepath.Join("assets", "repo-search",
-		cfg.Distribution+"_"+strings.ReplaceAll(carbon.Now().ToDateTimeString(), ":", "-")),
-		result.Repositories)
+	return result
 }
 
-func worker(id int, token string, jobs <-chan *QueryOpts, results chan<- *QueryResult) {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
+// progress of the queries and API quota of each token
+var searchTracker = progress.NewTracker("search", "queries")
+
+func searchCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	var progressOpts progress.Options
+	progressOpts.RegisterFlags(fs)
+	return func(cfg *config.Config) {
+		searchRepositories(cfg, &progressOpts)
+	}
+}
 
-	client := github.NewClient(tc)
+func searchRepositories(cfg *config.Config, progressOpts *progress.Options) {
+	// an interruption stops the workers, writing the repositories found so far
+	ctx, stop := util.InterruptContext()
+	defer stop()
 
+	credentials, err := auth.Load(cfg)
+	util.CheckError(err)
+	if len(credentials) == 0 {
+		log.Fatal("No GitHub credentials: set tokens in the config, GITHUB_TOKENS or a GitHub App")
+	}
+	// tokens shared by the workers, each query goes to the token with the most search quota left
+	pool := tokenpool.New(credentials, false)
+	util.CheckError(pool.Validate(ctx, cfg.RequiredScopes))
+	pool.OnResponse = searchTracker.UpdateQuota
+
+	jobs := make(chan *QueryOpts, 3*len(credentials))
+	results := make(chan *QueryResult, 3*len(credentials))
+	searchTracker.AddQueue("jobs", func() int { return len(jobs) })
+	searchTracker.AddQueue("results", func() int { return len(results) })
+	stopProgress := searchTracker.Start(progressOpts)
+
+	// errors of the queries, which stop the search
+	errs := make(chan error, len(credentials))
+	// create workers according to the GitHub credentials
+	for w := 0; w < len(credentials); w++ {
+		go searchWorker(ctx, w, pool, jobs, results, errs)
+	}
+
+	log.Printf("Starting search for %s\n", cfg.Distribution)
+
+	// repositories found so far, written as a partial result when interrupted
+	uniqueResults := NewUniqueResults()
+	done := make(chan *QueryResult)
+	go func() {
+		done <- search(cfg, jobs, results, uniqueResults)
+	}()
+
+	var result *QueryResult
+	partial := false
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		partial = true
+		result = &QueryResult{Repositories: uniqueResults.AsArray()}
+	case err := <-errs:
+		stopProgress()
+		log.Fatal(err)
+	}
+	stopProgress()
+	fileName := cfg.Distribution + "_" + strings.ReplaceAll(carbon.Now().ToDateTimeString(), ":", "-")
+	if partial {
+		// not taken by repo-retrieval
+		fileName += PARTIAL_SUFFIX
+		log.Printf("Search interrupted, partial results retrieved: %d\n", len(result.Repositories))
+	} else {
+		log.Printf("Total results: %d, Results retrieved: %d\n", result.Total, len(result.Repositories))
+	}
+	log.Println("Writing results...")
+	util.CheckError(util.WriteFolder(REPO_SEARCH_PATH))
+	util.CheckError(util.WriteJSON(filepath.Join(REPO_SEARCH_PATH, fileName), result.Repositories))
+}
+
+// a failed query is sent to errs, stopping the worker
+func searchWorker(ctx context.Context, id int, pool *tokenpool.Pool, jobs <-chan *QueryOpts, results chan<- *QueryResult,
+	errs chan<- error) {
 	opt := &github.SearchOptions{
 		ListOptions: github.ListOptions{PerPage: 100},
 	}
@@ -331,17 +400,21 @@ func worker(id int, token string, jobs <-chan *QueryOpts, results chan<- *QueryR
 
 		for { //handle pages
 			log.Println("worker:", id, "query:", j.Query)
-			repos, resp, err := client.Search.Repositories(ctx, j.Query, opt)
-
+			var repos *github.RepositoriesSearchResult
+			var resp *github.Response
+			// rate limits are waited for by the pool, which reexecutes the same query
+			err := pool.Do(ctx, tokenpool.SEARCH, func(client *github.Client) (*github.Response, error) {
+				var err error
+				repos, resp, err = client.Search.Repositories(ctx, j.Query, opt)
+				return resp, err
+			})
+			if ctx.Err() != nil {
+				// interrupted
+				return
+			}
 			if err != nil {
-				if _, ok := err.(*github.RateLimitError); ok {
-					d := resp.Rate.Reset.Time.Sub(time.Now())
-					log.Println("worker", id, "went to sleep for", fmt.Sprint(d.Minutes()), "minutes")
-					time.Sleep(d) //sleep and reexecute the same query again
-					continue
-				} else {
-					log.Fatal(err)
-				}
+				errs <- fmt.Errorf("worker %d, query %q: %w", id, j.Query, err)
+				return
 			}
 			queryResult.Repositories = append(queryResult.Repositories, repos.Repositories...)
 			if j.FirstPage {
@@ -353,6 +426,7 @@ func worker(id int, token string, jobs <-chan *QueryOpts, results chan<- *QueryR
 			}
 			opt.Page = resp.NextPage
 		}
+		searchTracker.AddDone(1)
 		results <- queryResult
 	}
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/processing"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+func statsCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	distributions := fs.String("distributions", "",
+		"comma-separated distributions searched by operators (as given to its -distributions flag, defaults to the configured one)")
+	return func(cfg *config.Config) {
+		summarizeOperators(cfg, parseDistributions(cfg, *distributions))
+	}
+}
+
+// loads the archives quarantined by operators, if any; they are left out of the summary
+func loadQuarantined(fileName string) map[string]string {
+	quarantined := make(map[string]string)
+	dat, err := os.ReadFile(fileName + "_quarantined.json")
+	if os.IsNotExist(err) {
+		return quarantined
+	}
+	util.CheckError(err)
+	util.CheckError(json.Unmarshal(dat, &quarantined))
+	return quarantined
+}
+
+func summarize(result map[string]map[string]int, quarantined map[string]string) *processing.StatsSummary {
+	for archive := range quarantined {
+		delete(result, archive)
+	}
+	return processing.Summarize(result)
+}
+
+// computes the statistical summary of the operators counted by operators
+func summarizeOperators(cfg *config.Config, dists []string) {
+	fileName := filepath.Join(config.OPERATORS_SEARCH_PATH, fmt.Sprintf("%s_%s",
+		strings.ToLower(strings.Join(dists, "-")), strings.Join(cfg.FileExtensions, "-")))
+	log.Printf("Summarizing %s.json", fileName)
+
+	dat, err := os.ReadFile(fileName + ".json")
+	util.CheckError(err)
+	quarantined := loadQuarantined(fileName)
+	if len(quarantined) > 0 {
+		log.Printf("Leaving %d quarantined archive(s) out", len(quarantined))
+	}
+
+	if len(dists) == 1 {
+		var result map[string]map[string]int
+		util.CheckError(json.Unmarshal(dat, &result))
+		summary := summarize(result, quarantined)
+		util.CheckError(summary.Write(fileName + "_stats"))
+		log.Printf("%d operator(s) used %d time(s) in %d of %d repositories", summary.OperatorsUsed,
+			summary.Total, summary.RxRepositories, summary.Repositories)
+	} else {
+		// results keyed by distribution
+		var results map[string]map[string]map[string]int
+		util.CheckError(json.Unmarshal(dat, &results))
+		for _, dist := range dists {
+			result, ok := results[dist]
+			if !ok {
+				log.Fatalf("No results of %s in %s.json", dist, fileName)
+			}
+			summary := summarize(result, quarantined)
+			util.CheckError(summary.Write(fileName + "_" + strings.ToLower(dist) + "_stats"))
+			log.Printf("%s: %d operator(s) used %d time(s) in %d of %d repositories", dist,
+				summary.OperatorsUsed, summary.Total, summary.RxRepositories, summary.Repositories)
+		}
+	}
+	log.Println("Done!")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/auth"
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/progress"
+	"github.com/carloszimm/github-mining/internal/tokenpool"
+	"github.com/carloszimm/github-mining/internal/util"
+	"github.com/google/go-github/v41/github"
+	"github.com/olekukonko/tablewriter"
+)
+
+const STARS = 10
+
+var (
+	FILE_NAME         = fmt.Sprintf("repos summary_%s.txt", util.NowDateTimeFormatted())
+	REPO_SUMMARY_PATH = filepath.Join("assets", "repo-summary", FILE_NAME)
+)
+
+var DISTRIBUTIONS [18]string = [18]string{
+	"RxJava", "RxJS", "Rx.NET", "UniRx", "RxScala", "RxClojure",
+	"RxCpp", "RxLua", "Rx.rb", "RxPY", "RxGo", "RxGroovy", "RxJRuby",
+	"RxKotlin", "RxSwift", "RxPHP", "reaxive", "RxDart"}
+
+func starsQuery(iteration int) string {
+	switch iteration {
+	case 1:
+		return " stars:0"
+	case 2:
+		return fmt.Sprintf(" stars:>=%d", STARS)
+	default:
+		return ""
+	}
+}
+
+func retrieveRepoInfoWorker(ctx context.Context, id int, pool *tokenpool.Pool, queries <-chan string,
+	results chan<- []string) {
+	// PerPage == 1 since we want the total not the results
+	opt := &github.SearchOptions{
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	for query := range queries {
+		result := []string{query}
+		for i := 0; i < 3; i++ {
+			// retried with a backoff until it succeeds, unless GitHub rejects the query
+			for attempt := 1; ; attempt++ {
+				var repos *github.RepositoriesSearchResult
+				// rate limits are waited for by the pool
+				err := pool.Do(ctx, tokenpool.SEARCH, func(client *github.Client) (*github.Response, error) {
+					var resp *github.Response
+					var err error
+					repos, resp, err = client.Search.Repositories(ctx, query+starsQuery(i), opt)
+					return resp, err
+				})
+				if ctx.Err() != nil {
+					// interrupted
+					return
+				}
+				if err != nil {
+					log.Printf("worker %d: %v", id, err)
+					if tokenpool.Rejected(err) {
+						result = append(result, "error")
+						break
+					}
+					if tokenpool.Backoff(ctx, attempt) != nil {
+						return
+					}
+					continue
+				}
+
+				result = append(result, strconv.Itoa(repos.GetTotal()))
+				break
+			}
+		}
+		summaryTracker.AddDone(1)
+		results <- result
+	}
+}
+
+// writes the table to path; a partial table (interrupted run) is captioned as such
+func writeData(path string, data [][]string, partial bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	table := tablewriter.NewWriter(f)
+	table.SetHeader([]string{"Distribution", "Total", "Stars = 0", fmt.Sprintf("Stars >= %d", STARS)})
+
+	table.AppendBulk(data)
+	if partial {
+		table.SetCaption(true, fmt.Sprintf("Partial: interrupted with %d of %d distributions queried",
+			len(data), len(DISTRIBUTIONS)))
+	}
+
+	table.Render()
+	return f.Close()
+}
+
+// progress of the distributions and API quota of each token
+var summaryTracker = progress.NewTracker("summary", "distributions")
+
+func summaryCommand(fs *flag.FlagSet) func(cfg *config.Config) {
+	var progressOpts progress.Options
+	progressOpts.RegisterFlags(fs)
+	return func(cfg *config.Config) {
+		summarizeDistributions(cfg, &progressOpts)
+	}
+}
+
+func summarizeDistributions(cfg *config.Config, progressOpts *progress.Options) {
+	// an interruption stops the workers, writing the distributions queried so far
+	ctx, stop := util.InterruptContext()
+	defer stop()
+
+	credentials, err := auth.Load(cfg)
+	util.CheckError(err)
+	if len(credentials) == 0 {
+		log.Fatal("No GitHub credentials: set tokens in the config, GITHUB_TOKENS or a GitHub App")
+	}
+	// tokens shared by the workers, each query goes to the token with the most search quota left
+	pool := tokenpool.New(credentials, false)
+	util.CheckError(pool.Validate(ctx, cfg.RequiredScopes))
+	pool.OnResponse = summaryTracker.UpdateQuota
+
+	jobs := make(chan string, 3*len(credentials))
+	results := make(chan []string, 3*len(credentials))
+	summaryTracker.SetTotal(len(DISTRIBUTIONS))
+	summaryTracker.AddQueue("jobs", func() int { return len(jobs) })
+	stopProgress := summaryTracker.Start(progressOpts)
+
+	// create workers according to the GitHub credentials
+	for i := range credentials {
+		go retrieveRepoInfoWorker(ctx, i, pool, jobs, results)
+	}
+
+	go func() {
+		for _, dist := range DISTRIBUTIONS {
+			select {
+			case jobs <- dist:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var queryResults [][]string
+	for len(queryResults) < len(DISTRIBUTIONS) && ctx.Err() == nil {
+		select {
+		case result := <-results:
+			queryResults = append(queryResults, result)
+		case <-ctx.Done():
+		}
+	}
+	stopProgress()
+
+	sort.SliceStable(queryResults, func(i, j int) bool {
+		totalI, _ := strconv.Atoi(queryResults[i][1])
+		totalJ, _ := strconv.Atoi(queryResults[j][1])
+		return totalI > totalJ
+	})
+
+	util.CheckError(util.WriteFolder(filepath.Dir(REPO_SUMMARY_PATH)))
+	path := REPO_SUMMARY_PATH
+	partial := len(queryResults) < len(DISTRIBUTIONS)
+	if partial {
+		path = strings.TrimSuffix(path, ".txt") + "_partial.txt"
+		log.Printf("Interrupted: writing the %d distribution(s) queried so far", len(queryResults))
+	}
+	util.CheckError(writeData(path, queryResults, partial))
+}
@@ -1,14 +1,16 @@
 module github.com/carloszimm/github-mining
 
-go 1.17
+go 1.18
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/dlclark/regexp2 v1.4.0
 	github.com/golang-module/carbon/v2 v2.0.1
 	github.com/google/go-github/v41 v41.0.0
 	github.com/iancoleman/orderedmap v0.2.0
 	github.com/olekukonko/tablewriter v0.0.5
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
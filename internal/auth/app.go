@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/google/go-github/v41/github"
+	"golang.org/x/oauth2"
+)
+
+// validity of the JWTs authenticating as the app (GitHub accepts up to 10 minutes)
+const JWT_VALIDITY = 9 * time.Minute
+
+// installation tokens are refreshed this long before they expire (after one hour),
+// so requests in flight never carry an expired token
+const REFRESH_MARGIN = 5 * time.Minute
+
+// timeout of the requests minting installation tokens
+const MINT_TIMEOUT = 30 * time.Second
+
+// a credential per installation of the app (the configured ones or else all of them),
+// each with its own quota
+func installationCredentials(app *config.GitHubApp) ([]Credential, error) {
+	key, err := loadPrivateKey(app)
+	if err != nil {
+		return nil, err
+	}
+	jwt := &jwtSource{appID: app.AppID, key: key}
+	client := github.NewClient(oauth2.NewClient(context.Background(), jwt))
+
+	ids := app.InstallationIDs
+	if len(ids) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), MINT_TIMEOUT)
+		defer cancel()
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			installations, resp, err := client.Apps.ListInstallations(ctx, opts)
+			if err != nil {
+				return nil, fmt.Errorf("listing installations: %w", err)
+			}
+			for _, installation := range installations {
+				ids = append(ids, installation.GetID())
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+		if len(ids) == 0 {
+			return nil, errors.New("app not installed anywhere")
+		}
+	}
+
+	var credentials []Credential
+	for _, id := range ids {
+		source := &installationSource{client: client, installationID: id}
+		credentials = append(credentials, Credential{Label: fmt.Sprintf("installation-%d", id),
+			Source: oauth2.ReuseTokenSource(nil, source)})
+	}
+	return credentials, nil
+}
+
+// parses the PKCS#1 (as generated by GitHub) or PKCS#8 private key of the app
+func loadPrivateKey(app *config.GitHubApp) (*rsa.PrivateKey, error) {
+	data := []byte(app.PrivateKey)
+	if len(data) == 0 {
+		var err error
+		if data, err = os.ReadFile(app.PrivateKeyPath); err != nil {
+			return nil, fmt.Errorf("private key: %w", err)
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM-encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// JWTs (RS256) authenticating as the app, used only to mint installation tokens
+type jwtSource struct {
+	appID int64
+	key   *rsa.PrivateKey
+}
+
+func (s *jwtSource) Token() (*oauth2.Token, error) {
+	// issued in the past to allow for clock drift
+	now := time.Now().Add(-time.Minute)
+	expiry := now.Add(JWT_VALIDITY)
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{"iat": now.Unix(), "exp": expiry.Unix(), "iss": s.appID})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: unsigned + "." + base64.RawURLEncoding.EncodeToString(signature),
+		TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+// tokens of an installation, minted again by oauth2.ReuseTokenSource as they expire
+type installationSource struct {
+	client         *github.Client
+	installationID int64
+}
+
+func (s *installationSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), MINT_TIMEOUT)
+	defer cancel()
+	token, _, err := s.client.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("installation %d token: %w", s.installationID, err)
+	}
+	return &oauth2.Token{AccessToken: token.GetToken(), TokenType: "token",
+		Expiry: token.GetExpiresAt().Add(-REFRESH_MARGIN)}, nil
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"golang.org/x/oauth2"
+)
+
+// source of the tokens of a credential; tokens minted for GitHub App installations
+// are refreshed by the source as they expire
+type Credential struct {
+	// identifies the credential in logs and metrics, never its value
+	Label  string
+	Source oauth2.TokenSource
+}
+
+// loads the credentials from the configuration's tokens and its tokens file, followed by
+// the installations of the GitHub App, if any; the environment's credentials are applied
+// to the configuration when it's loaded (see config.CredentialsEnv)
+func Load(cfg *config.Config) ([]Credential, error) {
+	tokens, err := loadTokens(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var credentials []Credential
+	for i, token := range tokens {
+		credentials = append(credentials, Credential{Label: fmt.Sprintf("token-%d", i),
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})})
+	}
+
+	app, err := appConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if app != nil {
+		installations, err := installationCredentials(app)
+		if err != nil {
+			return nil, fmt.Errorf("GitHub App %d: %w", app.AppID, err)
+		}
+		credentials = append(credentials, installations...)
+	}
+	return credentials, nil
+}
+
+// tokens without duplicates, in the order: configuration, tokens file
+func loadTokens(cfg *config.Config) ([]string, error) {
+	tokens := append([]string{}, cfg.Tokens...)
+	if cfg.TokensFile != "" {
+		fileTokens, err := readTokensFile(cfg.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+
+	seen := make(map[string]bool)
+	unique := tokens[:0]
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); token != "" && !seen[token] {
+			seen[token] = true
+			unique = append(unique, token)
+		}
+	}
+	return unique, nil
+}
+
+// reads a token per line, skipping blank lines and comments (#)
+func readTokensFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("tokens file: %w", err)
+	}
+	defer file.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("tokens file %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+// GitHub App of the configuration, nil if none
+func appConfig(cfg *config.Config) (*config.GitHubApp, error) {
+	if cfg.GitHubApp == nil {
+		return nil, nil
+	}
+	app := *cfg.GitHubApp
+	if app.AppID == 0 && app.PrivateKey == "" && app.PrivateKeyPath == "" {
+		return nil, nil
+	}
+	if app.AppID == 0 {
+		return nil, fmt.Errorf("GitHub App without an id (set github_app_id or GITHUB_APP_ID)")
+	}
+	if app.PrivateKey == "" && app.PrivateKeyPath == "" {
+		return nil, fmt.Errorf("GitHub App %d without a private key (set github_app_private_key_path, "+
+			"GITHUB_APP_PRIVATE_KEY or GITHUB_APP_PRIVATE_KEY_PATH)", app.AppID)
+	}
+	return &app, nil
+}
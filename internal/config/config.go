@@ -1,48 +1,197 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
-	"github.com/carloszimm/github-mining/internal/util"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
+const CONFIG_DIR = "configs"
+
+// extensions of the supported configuration formats, in the order files are looked for
+var FORMATS = []string{".json", ".yaml", ".yml", ".toml"}
+
 var (
+	PROFILES_PATH         = filepath.Join(CONFIG_DIR, "profiles")
 	REPO_RETRIVAL_PATH    = filepath.Join("assets", "repo-retrieval")
 	OPERATORS_PATH        = filepath.Join("assets", "operators")
 	OPERATORS_SEARCH_PATH = filepath.Join("assets", "operators-search")
 	FALSE_POSITIVES_PATH  = filepath.Join("assets", "false-positives")
+	EXTENSIONS_PATH       = filepath.Join("assets", "Programming_Languages_Extensions.json")
 )
 var PROCESSING_WORKERS = runtime.NumCPU()
 
 const ARCHIVES_FOLDER = "archives"
 
 type Config struct {
-	Tokens         []string `json:"tokens" validate:"required"`
-	Distribution   string   `json:"distribution" validate:"required"`
-	MinStars       int      `json:"min_stars" validate:"required"`
-	IncreaseFactor int      `json:"increase_factor" validate:"required"`
-	FileExtensions []string `json:"file_extensions"`
+	// tokens are also read from TokensFile and the environment (see internal/auth)
+	Tokens         []string `json:"tokens" yaml:"tokens" toml:"tokens"`
+	Distribution   string   `json:"distribution" yaml:"distribution" toml:"distribution" validate:"required"`
+	MinStars       int      `json:"min_stars" yaml:"min_stars" toml:"min_stars" validate:"min=0"`
+	IncreaseFactor int      `json:"increase_factor" yaml:"increase_factor" toml:"increase_factor" validate:"min=1"`
+	FileExtensions []string `json:"file_extensions" yaml:"file_extensions" toml:"file_extensions"`
+	// distribution -> libraries whose methods may be mistaken for its operators
+	ConfoundingLibraries map[string][]ConfoundingLibrary `json:"confounding_libraries" yaml:"confounding_libraries" toml:"confounding_libraries"`
+	// file with a token per line, so tokens can be kept outside the repository
+	TokensFile string `json:"tokens_file" yaml:"tokens_file" toml:"tokens_file"`
+	// app whose installation tokens are used along with the tokens
+	GitHubApp *GitHubApp `json:"github_app" yaml:"github_app" toml:"github_app"`
+	// OAuth scopes every token must have, checked before the requests start
+	RequiredScopes []string `json:"required_scopes" yaml:"required_scopes" toml:"required_scopes"`
+}
+
+type GitHubApp struct {
+	AppID int64 `json:"app_id" yaml:"app_id" toml:"app_id" validate:"required"`
+	// installations whose tokens are used, all of the app's if empty
+	InstallationIDs []int64 `json:"installation_ids" yaml:"installation_ids" toml:"installation_ids"`
+	PrivateKeyPath  string  `json:"private_key_path" yaml:"private_key_path" toml:"private_key_path"`
+	// PEM-encoded key, only taken from the environment
+	PrivateKey string `json:"-" yaml:"-" toml:"-"`
+}
+
+// library detected by its imports: regular expressions matched against the imported modules
+type ConfoundingLibrary struct {
+	Name    string   `json:"name" yaml:"name" toml:"name" validate:"required"`
+	Imports []string `json:"imports" yaml:"imports" toml:"imports" validate:"required"`
+}
+
+// values of the keys missing from every layer, the ones used in the paper
+func Defaults() *Config {
+	return &Config{MinStars: 10, IncreaseFactor: 50}
+}
+
+// returns the first configuration file found in CONFIG_DIR (config.json, .yaml, .yml or
+// .toml), empty if there is none
+func FindFile() string {
+	for _, ext := range FORMATS {
+		path := filepath.Join(CONFIG_DIR, "config"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
 }
 
-var instance *Config
+// decodes the file over cfg according to its extension, keys not present being kept;
+// unknown keys are reported as errors
+func decodeFile(cfg *Config, path string) error {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(dat))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(dat))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+		if err == io.EOF {
+			// empty document
+			err = nil
+		}
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(dat), cfg)
+		if undecoded := md.Undecoded(); err == nil && len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			err = fmt.Errorf("unknown key(s) %s", strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("unsupported format %q, expected one of %s", filepath.Ext(path), strings.Join(FORMATS, ", "))
+	}
+	return err
+}
+
+// returns the file of the profile, given by name (a file in PROFILES_PATH) or path
+func profileFile(profile string) (string, error) {
+	if strings.ContainsAny(profile, `/\`) || filepath.Ext(profile) != "" {
+		return profile, nil
+	}
+	for _, ext := range FORMATS {
+		path := filepath.Join(PROFILES_PATH, profile+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	var names []string
+	entries, _ := os.ReadDir(PROFILES_PATH)
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("unknown profile %q, there are no profiles in %s", profile, PROFILES_PATH)
+	}
+	return "", fmt.Errorf("unknown profile %q, available: %s", profile, strings.Join(names, ", "))
+}
 
-func init() {
-	instance = readConfig()
+// sources of a configuration, from the lowest precedence to the highest: the defaults,
+// a file, a profile, the environment and the flags
+type Layers struct {
+	// configuration file, none if empty
+	File string
+	// name or path of the profile applied over the file, none if empty (or taken from
+	// ENV_PROFILE when Environ has it)
+	Profile string
+	// environment as returned by os.Environ, the GHMINE_ variables overriding the keys
+	Environ []string
+	// applies the flags given (see RegisterFlags), optional
+	Flags func(cfg *Config) error
 }
 
-func readConfig() *Config {
-	dat, err := os.ReadFile(filepath.Join("configs", "config.json"))
-	util.CheckError(err)
+// merges the layers into a configuration, which is then validated
+func (l *Layers) Load() (*Config, error) {
+	cfg := Defaults()
+	if l.File != "" {
+		if err := decodeFile(cfg, l.File); err != nil {
+			return nil, fmt.Errorf("configuration %s: %w", l.File, err)
+		}
+	}
 
-	var config Config
-	json.Unmarshal(dat, &config)
+	profile := l.Profile
+	if value, ok := lookupEnv(l.Environ, ENV_PROFILE); ok && profile == "" {
+		profile = value
+	}
+	if profile != "" {
+		path, err := profileFile(profile)
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeFile(cfg, path); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", path, err)
+		}
+	}
 
-	return &config
+	if err := ApplyEnv(cfg, l.Environ); err != nil {
+		return nil, err
+	}
+	if l.Flags != nil {
+		if err := l.Flags(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func GetConfigInstance() *Config {
-	return instance
+// loads the configuration file found in CONFIG_DIR along with the profile and the
+// overrides of the environment
+func LoadDefault() (*Config, error) {
+	return (&Layers{File: FindFile(), Environ: os.Environ()}).Load()
 }
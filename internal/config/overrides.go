@@ -0,0 +1,247 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prefix of the environment variables overriding the configuration
+const ENV_PREFIX = "GHMINE_"
+
+// environment variables selecting the layers instead of overriding keys
+const (
+	ENV_CONFIG  = ENV_PREFIX + "CONFIG"
+	ENV_PROFILE = ENV_PREFIX + "PROFILE"
+	ENV_WORKDIR = ENV_PREFIX + "WORKDIR"
+)
+
+// key of the configuration that can be overridden by a flag named after it or by
+// the environment variable ENV_PREFIX + the key in upper case
+type Override struct {
+	// key in config.json, nested keys joined by _
+	Key   string
+	Usage string
+	set   func(cfg *Config, value string) error
+}
+
+func (o *Override) Env() string {
+	return ENV_PREFIX + strings.ToUpper(o.Key)
+}
+
+// overrides of every key of the configuration; lists are comma-separated
+var Overrides = []*Override{
+	{Key: "tokens", Usage: "comma-separated GitHub tokens",
+		set: func(cfg *Config, value string) error {
+			cfg.Tokens = splitList(value)
+			return nil
+		}},
+	{Key: "distribution", Usage: "distribution (Rx library) mined, e.g. RxJava",
+		set: func(cfg *Config, value string) error {
+			cfg.Distribution = value
+			return nil
+		}},
+	{Key: "min_stars", Usage: "minimum number of stars of the repositories searched",
+		set: func(cfg *Config, value string) (err error) {
+			cfg.MinStars, err = strconv.Atoi(value)
+			return
+		}},
+	{Key: "increase_factor", Usage: "width of the star intervals of the repositories search",
+		set: func(cfg *Config, value string) (err error) {
+			cfg.IncreaseFactor, err = strconv.Atoi(value)
+			return
+		}},
+	{Key: "file_extensions", Usage: "comma-separated entries of Programming_Languages_Extensions.json searched",
+		set: func(cfg *Config, value string) error {
+			cfg.FileExtensions = splitList(value)
+			return nil
+		}},
+	{Key: "confounding_libraries", Usage: "confounding libraries of each distribution, as a JSON object",
+		set: func(cfg *Config, value string) error {
+			var libraries map[string][]ConfoundingLibrary
+			if err := json.Unmarshal([]byte(value), &libraries); err != nil {
+				return err
+			}
+			cfg.ConfoundingLibraries = libraries
+			return nil
+		}},
+	{Key: "tokens_file", Usage: "file with a GitHub token per line",
+		set: func(cfg *Config, value string) error {
+			cfg.TokensFile = value
+			return nil
+		}},
+	{Key: "github_app_id", Usage: "ID of the GitHub App whose installation tokens are used",
+		set: func(cfg *Config, value string) (err error) {
+			app := cfg.gitHubApp()
+			app.AppID, err = strconv.ParseInt(value, 10, 64)
+			return
+		}},
+	{Key: "github_app_installation_ids", Usage: "comma-separated installations of the GitHub App (all if empty)",
+		set: func(cfg *Config, value string) error {
+			app := cfg.gitHubApp()
+			app.InstallationIDs = nil
+			for _, id := range splitList(value) {
+				n, err := strconv.ParseInt(id, 10, 64)
+				if err != nil {
+					return err
+				}
+				app.InstallationIDs = append(app.InstallationIDs, n)
+			}
+			return nil
+		}},
+	{Key: "github_app_private_key_path", Usage: "PEM file with the private key of the GitHub App",
+		set: func(cfg *Config, value string) error {
+			cfg.gitHubApp().PrivateKeyPath = value
+			return nil
+		}},
+	{Key: "required_scopes", Usage: "comma-separated OAuth scopes every token must have",
+		set: func(cfg *Config, value string) error {
+			cfg.RequiredScopes = splitList(value)
+			return nil
+		}},
+}
+
+// environment variables with credentials, applied before the GHMINE_ ones; tokens are
+// added to the configuration's instead of replacing them and empty variables are ignored
+var CredentialsEnv = []struct {
+	Env string
+	set func(cfg *Config, value string) error
+}{
+	// tokens separated by commas or whitespace
+	{Env: "GITHUB_TOKENS", set: func(cfg *Config, value string) error {
+		cfg.Tokens = append(cfg.Tokens, strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		})...)
+		return nil
+	}},
+	{Env: "GITHUB_TOKEN", set: func(cfg *Config, value string) error {
+		cfg.Tokens = append(cfg.Tokens, strings.TrimSpace(value))
+		return nil
+	}},
+	// file with a token per line
+	{Env: "GITHUB_TOKENS_FILE", set: overrideSetter("tokens_file")},
+	{Env: "GITHUB_APP_ID", set: overrideSetter("github_app_id")},
+	// installations separated by commas (all of the app's if unset)
+	{Env: "GITHUB_APP_INSTALLATION_IDS", set: overrideSetter("github_app_installation_ids")},
+	// PEM-encoded private key of the app, only taken from the environment
+	{Env: "GITHUB_APP_PRIVATE_KEY", set: func(cfg *Config, value string) error {
+		cfg.gitHubApp().PrivateKey = value
+		return nil
+	}},
+	{Env: "GITHUB_APP_PRIVATE_KEY_PATH", set: overrideSetter("github_app_private_key_path")},
+}
+
+// setter of the override of key, called once Overrides is initialized
+func overrideSetter(key string) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		for _, o := range Overrides {
+			if o.Key == key {
+				return o.set(cfg, value)
+			}
+		}
+		return fmt.Errorf("no override for %s", key)
+	}
+}
+
+// returns the GitHub App of the configuration, creating it when needed
+func (cfg *Config) gitHubApp() *GitHubApp {
+	if cfg.GitHubApp == nil {
+		cfg.GitHubApp = &GitHubApp{}
+	}
+	return cfg.GitHubApp
+}
+
+func (o *Override) apply(cfg *Config, value, source string) error {
+	if err := o.set(cfg, value); err != nil {
+		return fmt.Errorf("invalid %s %q: %w", source, value, err)
+	}
+	return nil
+}
+
+// applies the credentials and the overrides set in environ (as returned by os.Environ);
+// GHMINE_ variables matching no key are reported, as they are likely misspelled
+func ApplyEnv(cfg *Config, environ []string) error {
+	for _, c := range CredentialsEnv {
+		if value, ok := lookupEnv(environ, c.Env); ok && strings.TrimSpace(value) != "" {
+			if err := c.set(cfg, value); err != nil {
+				return fmt.Errorf("invalid %s: %w", c.Env, err)
+			}
+		}
+	}
+	known := map[string]bool{ENV_CONFIG: true, ENV_PROFILE: true, ENV_WORKDIR: true}
+	for _, o := range Overrides {
+		known[o.Env()] = true
+		if value, ok := lookupEnv(environ, o.Env()); ok {
+			if err := o.apply(cfg, value, o.Env()); err != nil {
+				return err
+			}
+		}
+	}
+	var unknown []string
+	for _, entry := range environ {
+		if key := strings.SplitN(entry, "=", 2)[0]; strings.HasPrefix(key, ENV_PREFIX) && !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown configuration variable(s) %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// value of the last entry of key in environ
+func lookupEnv(environ []string, key string) (value string, ok bool) {
+	for _, entry := range environ {
+		if strings.HasPrefix(entry, key+"=") {
+			value, ok = entry[len(key)+1:], true
+		}
+	}
+	return
+}
+
+// value of an override flag, kept until the configuration is loaded
+type overrideValue struct {
+	value string
+	set   bool
+}
+
+func (v *overrideValue) String() string {
+	return v.value
+}
+
+func (v *overrideValue) Set(value string) error {
+	v.value, v.set = value, true
+	return nil
+}
+
+// registers a flag per override on fs; the returned function applies the flags given
+// to a configuration
+func RegisterFlags(fs *flag.FlagSet) (apply func(cfg *Config) error) {
+	values := make([]*overrideValue, len(Overrides))
+	for i, o := range Overrides {
+		values[i] = &overrideValue{}
+		fs.Var(values[i], o.Key, o.Usage)
+	}
+	return func(cfg *Config) error {
+		for i, o := range Overrides {
+			if values[i].set {
+				if err := o.apply(cfg, values[i].value, "-"+o.Key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	cfg := &Config{Tokens: []string{"file"}, MinStars: 10}
+	err := ApplyEnv(cfg, []string{
+		"GITHUB_TOKENS=a, b\tc", "GITHUB_TOKEN=d", "GITHUB_APP_ID=",
+		"GHMINE_MIN_STARS=5", "GHMINE_MIN_STARS=7", "GHMINE_FILE_EXTENSIONS=Java, Kotlin,",
+		"GHMINE_GITHUB_APP_INSTALLATION_IDS=1,2", "GHMINE_PROFILE=ci",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{Tokens: []string{"file", "a", "b", "c", "d"}, MinStars: 7,
+		FileExtensions: []string{"Java", "Kotlin"}, GitHubApp: &GitHubApp{InstallationIDs: []int64{1, 2}}}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("ApplyEnv = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	tests := []struct {
+		env, want string
+	}{
+		{"GHMINE_MIN_STAR=5", "unknown configuration variable(s) GHMINE_MIN_STAR"},
+		{"GHMINE_MIN_STARS=many", `invalid GHMINE_MIN_STARS "many"`},
+		{"GITHUB_APP_ID=app", "invalid GITHUB_APP_ID"},
+		{`GHMINE_CONFOUNDING_LIBRARIES={"RxJava": [`, "invalid GHMINE_CONFOUNDING_LIBRARIES"},
+	}
+	for _, tt := range tests {
+		if err := ApplyEnv(&Config{}, []string{tt.env}); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("ApplyEnv(%s) = %v, want %s", tt.env, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	apply := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-distribution", "RxJS", "-tokens", "a,b"}); err != nil {
+		t.Fatal(err)
+	}
+	// flags not given keep the values of the other layers
+	cfg := &Config{MinStars: 10, Distribution: "RxJava"}
+	if err := apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Config{MinStars: 10, Distribution: "RxJS", Tokens: []string{"a", "b"}}); !reflect.DeepEqual(cfg, want) {
+		t.Errorf("apply = %+v, want %+v", cfg, want)
+	}
+}
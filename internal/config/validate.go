@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// checks the rules in the validate tags of the configuration: required (not the zero
+// value, nor empty) and min=N (numbers); structs in pointers, slices and maps are
+// checked as well, the problems being reported by their keys
+func (cfg *Config) Validate() error {
+	var problems []string
+	validateValue(reflect.ValueOf(cfg).Elem(), "", &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, path string, problems *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			validateValue(v.Elem(), path, problems)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			validateValue(v.MapIndex(key), fmt.Sprintf("%s.%v", path, key), problems)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := strings.Split(field.Tag.Get("json"), ",")[0]
+			if key == "-" {
+				continue
+			}
+			if path != "" {
+				key = path + "." + key
+			}
+			for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+				if problem := checkRule(v.Field(i), rule); problem != "" {
+					*problems = append(*problems, key+" "+problem)
+				}
+			}
+			validateValue(v.Field(i), key, problems)
+		}
+	}
+}
+
+// returns the problem of the value with the rule, empty if there is none
+func checkRule(v reflect.Value, rule string) string {
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	switch name {
+	case "":
+	case "required":
+		switch v.Kind() {
+		case reflect.Slice, reflect.Map, reflect.String:
+			if v.Len() == 0 {
+				return "is required"
+			}
+		default:
+			if v.IsZero() {
+				return "is required"
+			}
+		}
+	case "min":
+		min, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("invalid validate rule %q", rule))
+		}
+		if v.Int() < min {
+			return fmt.Sprintf("must be at least %d, got %d", min, v.Int())
+		}
+	default:
+		panic(fmt.Sprintf("unknown validate rule %q", rule))
+	}
+	return ""
+}
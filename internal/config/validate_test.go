@@ -0,0 +1,38 @@
+package config
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(cfg *Config)
+		want string
+	}{
+		{"valid", func(cfg *Config) {}, ""},
+		{"distribution missing", func(cfg *Config) { cfg.Distribution = "" },
+			"invalid configuration: distribution is required"},
+		{"below minimums", func(cfg *Config) { cfg.MinStars, cfg.IncreaseFactor = -1, 0 },
+			"invalid configuration: min_stars must be at least 0, got -1; increase_factor must be at least 1, got 0"},
+		{"app without id", func(cfg *Config) { cfg.GitHubApp = &GitHubApp{PrivateKeyPath: "key.pem"} },
+			"invalid configuration: github_app.app_id is required"},
+		{"nested libraries", func(cfg *Config) {
+			cfg.ConfoundingLibraries = map[string][]ConfoundingLibrary{
+				"RxJava": {{Name: "Streams", Imports: []string{"java.util.stream"}}, {Name: "Guava"}},
+			}
+		}, "invalid configuration: confounding_libraries.RxJava[1].imports is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Defaults()
+			cfg.Distribution = "RxJava"
+			tt.cfg(cfg)
+			got := ""
+			if err := cfg.Validate(); err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/carloszimm/github-mining/internal/progress"
+)
+
+// size of the buffer between stages, whose length is reported as the depth of the
+// queue feeding the next stage
+const QUEUE_SIZE = 32
+
+// stages chained over typed channels; they share the pipeline's context, cancelled when
+// its parent is or on the first error of any stage, and report their errors to Errors
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// receives the stages' counters and queue depths (optional)
+	tracker *progress.Tracker
+
+	// running sources and stages
+	wg sync.WaitGroup
+	// sent by the workers and forwarded to out, so workers never wait for a reader
+	errs chan error
+	out  chan error
+	once sync.Once
+
+	mu     sync.Mutex
+	stages []*stage
+}
+
+// error returned by the function of a stage
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+type stage struct {
+	name    string
+	workers int
+	in, out int64
+	errors  int64
+	// nanoseconds
+	busy int64
+}
+
+func (s *stage) stats() progress.StageStats {
+	return progress.StageStats{Stage: s.name, Workers: s.workers, In: atomic.LoadInt64(&s.in),
+		Out: atomic.LoadInt64(&s.out), Errors: atomic.LoadInt64(&s.errors),
+		Busy: time.Duration(atomic.LoadInt64(&s.busy))}
+}
+
+func New(ctx context.Context, tracker *progress.Tracker) *Pipeline {
+	p := &Pipeline{tracker: tracker, errs: make(chan error), out: make(chan error)}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	go p.forwardErrors()
+	return p
+}
+
+// context given to the stages' functions
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// emits the items to the returned channel until all of them were sent or the pipeline
+// is cancelled
+func Source[T any](p *Pipeline, items []T) <-chan T {
+	out := make(chan T, QUEUE_SIZE)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(out)
+		for _, item := range items {
+			select {
+			case out <- item:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// runs workers goroutines calling fn with the items of in, the items passed to emit
+// being sent to the returned channel, closed once in is closed and all workers finished.
+// An error returned by fn is sent to Errors and cancels the pipeline; the items left are
+// still passed to fn, with the context cancelled, so every stage drains its input and
+// the last channel must be read until it's closed
+func Stage[I, O any](p *Pipeline, name string, workers int, in <-chan I,
+	fn func(ctx context.Context, item I, emit func(O)) error) <-chan O {
+	if workers < 1 {
+		workers = 1
+	}
+	s := &stage{name: name, workers: workers}
+	p.mu.Lock()
+	p.stages = append(p.stages, s)
+	p.mu.Unlock()
+	p.tracker.AddQueue(name, func() int { return len(in) })
+	p.tracker.AddStage(name, s.stats)
+
+	out := make(chan O, QUEUE_SIZE)
+	emit := func(item O) {
+		out <- item
+		atomic.AddInt64(&s.out, 1)
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	p.wg.Add(1)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for item := range in {
+				atomic.AddInt64(&s.in, 1)
+				start := time.Now()
+				err := fn(p.ctx, item, emit)
+				atomic.AddInt64(&s.busy, int64(time.Since(start)))
+				if err != nil {
+					atomic.AddInt64(&s.errors, 1)
+					p.errs <- &StageError{Stage: name, Err: err}
+					p.cancel()
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+		p.wg.Done()
+	}()
+	return out
+}
+
+// keeps the errors of the workers until they are read from out, closing it once all
+// stages finished
+func (p *Pipeline) forwardErrors() {
+	defer close(p.out)
+	var queue []error
+	in := p.errs
+	for in != nil || len(queue) > 0 {
+		var out chan error
+		var next error
+		if len(queue) > 0 {
+			out, next = p.out, queue[0]
+		}
+		select {
+		case err, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			queue = append(queue, err)
+		case out <- next:
+			queue = queue[1:]
+		}
+	}
+}
+
+// returns the channel receiving the errors of the stages (*StageError), closed once
+// all of them finished; it must be called after all stages were added
+func (p *Pipeline) Errors() <-chan error {
+	p.once.Do(func() {
+		go func() {
+			p.wg.Wait()
+			p.cancel()
+			close(p.errs)
+		}()
+	})
+	return p.out
+}
+
+// waits for all stages to finish, returning the first error of them; it must be
+// called after all stages were added, instead of reading Errors
+func (p *Pipeline) Wait() error {
+	var first error
+	for err := range p.Errors() {
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// counters of the stages, in the order they were added
+func (p *Pipeline) Stats() []progress.StageStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]progress.StageStats, len(p.stages))
+	for i, s := range p.stages {
+		stats[i] = s.stats()
+	}
+	return stats
+}
@@ -0,0 +1,302 @@
+package processing
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// max number of bytes scanned looking for the closing bracket of a call
+const MAX_CALL_LENGTH = 64 * 1024
+
+// name of the RxJS (and similar) function/method whose arguments are operators
+const PIPE = "pipe"
+
+// extracts the sequences of operators composed together in a text (with comments and strings
+// already blanked out), both as dot-chaining (.map(...).filter(...)) and as arguments of
+// pipe (pipe(map(...), filter(...))); offsets are the ones returned by Operators.Match
+// calls of other methods and property accesses (e.g. .rx.tap) don't break a chain
+func extractChains(content string, offsets [][]int, operators []string) [][]string {
+	opAt := make(map[int]int)
+	var starts []int
+	for op, opOffsets := range offsets {
+		for _, offset := range opOffsets {
+			opAt[offset] = op
+			starts = append(starts, offset)
+		}
+	}
+	for _, offset := range findCalls(content, PIPE) {
+		if _, ok := opAt[offset]; !ok {
+			starts = append(starts, offset)
+		}
+	}
+	sort.Ints(starts)
+
+	ce := &chainExtractor{content: content, opAt: opAt, operators: operators,
+		consumed: make(map[int]struct{})}
+	var chains [][]string
+	for _, start := range starts {
+		if _, ok := ce.consumed[start]; ok {
+			continue
+		}
+		if chain := ce.walk(start); len(chain) > 0 {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+type chainExtractor struct {
+	content   string
+	opAt      map[int]int
+	operators []string
+	// operators already part of a chain
+	consumed map[int]struct{}
+}
+
+// follows the chain that starts with the identifier at offset
+func (ce *chainExtractor) walk(offset int) []string {
+	var chain []string
+	for offset >= 0 {
+		nameEnd := identifierEnd(ce.content, offset)
+		end := callEnd(ce.content, nameEnd)
+		if op, ok := ce.opAt[offset]; ok {
+			ce.consumed[offset] = struct{}{}
+			chain = append(chain, ce.operators[op])
+		} else if ce.content[offset:nameEnd] == PIPE && end > 0 {
+			chain = append(chain, ce.pipeArguments(nameEnd)...)
+		}
+		if end < 0 {
+			end = nameEnd
+		}
+		offset = nextLink(ce.content, end)
+	}
+	return chain
+}
+
+// returns the operators passed as arguments to the pipe call at nameEnd
+func (ce *chainExtractor) pipeArguments(nameEnd int) []string {
+	var chain []string
+	open := skipSpaces(ce.content, nameEnd)
+	close := matchBracket(ce.content, open)
+	for _, arg := range splitArguments(ce.content, open+1, close) {
+		if op, ok := ce.opAt[arg]; ok {
+			ce.consumed[arg] = struct{}{}
+			chain = append(chain, ce.operators[op])
+		}
+	}
+	return chain
+}
+
+// returns the offsets of the calls (name followed by a bracket) of a function or method
+func findCalls(content, name string) []int {
+	var offsets []int
+	for i := 0; ; {
+		j := strings.Index(content[i:], name)
+		if j < 0 {
+			return offsets
+		}
+		start, end := i+j, i+j+len(name)
+		i = end
+		if start > 0 {
+			r, _ := utf8.DecodeLastRuneInString(content[:start])
+			if isIdentifierRune(r) {
+				continue
+			}
+		}
+		if callEnd(content, end) > 0 {
+			offsets = append(offsets, start)
+		}
+	}
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func identifierEnd(content string, offset int) int {
+	for offset < len(content) {
+		r, size := utf8.DecodeRuneInString(content[offset:])
+		if !isIdentifierRune(r) {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+func skipSpaces(content string, offset int) int {
+	for offset < len(content) {
+		r, size := utf8.DecodeRuneInString(content[offset:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+// returns where the call whose name ends at nameEnd ends, including a trailing
+// closure (Swift/Kotlin), or -1 if the name isn't followed by a call
+func callEnd(content string, nameEnd int) int {
+	i := skipSpaces(content, nameEnd)
+	if i >= len(content) || (content[i] != '(' && content[i] != '{') {
+		return -1
+	}
+	end := matchBracket(content, i)
+	if end < 0 {
+		return -1
+	}
+	if content[i] == '(' {
+		// .subscribe(onNext: ...) { ... }
+		if j := skipSpaces(content, end+1); j < len(content) && content[j] == '{' {
+			if closure := matchBracket(content, j); closure > 0 {
+				end = closure
+			}
+		}
+	}
+	return end + 1
+}
+
+// returns the offset of the bracket closing the one at open, or -1
+func matchBracket(content string, open int) int {
+	depth := 0
+	limit := open + MAX_CALL_LENGTH
+	if limit > len(content) {
+		limit = len(content)
+	}
+	for i := open; i < limit; i++ {
+		switch content[i] {
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// returns the offset of the identifier chained (with . ?. or !!.) after offset, or -1
+func nextLink(content string, offset int) int {
+	i := skipSpaces(content, offset)
+	switch {
+	case strings.HasPrefix(content[i:], "?."):
+		i += 2
+	case strings.HasPrefix(content[i:], "!!."):
+		i += 3
+	case strings.HasPrefix(content[i:], "."):
+		i++
+	default:
+		return -1
+	}
+	i = skipSpaces(content, i)
+	// Java type witnesses: .<String>map(...)
+	if i < len(content) && content[i] == '<' {
+		if j := strings.IndexByte(content[i:], '>'); j > 0 {
+			i = skipSpaces(content, i+j+1)
+		}
+	}
+	if identifierEnd(content, i) == i {
+		return -1
+	}
+	return i
+}
+
+// returns the start offsets of the top-level arguments between open and close
+func splitArguments(content string, open, close int) []int {
+	if close < 0 {
+		return nil
+	}
+	var args []int
+	depth := 0
+	argStart := open
+	for i := open; i <= close; i++ {
+		switch content[i] {
+		case '(', '{', '[':
+			depth++
+		case ')', '}', ']':
+			depth--
+		}
+		if (content[i] == ',' && depth == 0) || i == close {
+			args = append(args, skipSpaces(content, argStart))
+			argStart = i + 1
+		}
+	}
+	return args
+}
+
+// type to store the frequencies of operators' n-grams found in chains
+type NGrams struct {
+	Chains   int            `json:"chains"`
+	Lengths  map[int]int    `json:"lengths,omitempty"`
+	Bigrams  map[string]int `json:"bigrams,omitempty"`
+	Trigrams map[string]int `json:"trigrams,omitempty"`
+}
+
+type NGramCount struct {
+	NGram []string `json:"ngram"`
+	Count int      `json:"count"`
+}
+
+type NGramsResult struct {
+	Chains   int          `json:"chains"`
+	Lengths  map[int]int  `json:"lengths"`
+	Bigrams  []NGramCount `json:"bigrams"`
+	Trigrams []NGramCount `json:"trigrams"`
+}
+
+func NewNGrams() *NGrams {
+	return &NGrams{Lengths: make(map[int]int),
+		Bigrams: make(map[string]int), Trigrams: make(map[string]int)}
+}
+
+func (ng *NGrams) Add(chains [][]string) {
+	for _, chain := range chains {
+		ng.Chains++
+		ng.Lengths[len(chain)]++
+		for i := 0; i+1 < len(chain); i++ {
+			ng.Bigrams[strings.Join(chain[i:i+2], " ")]++
+			if i+2 < len(chain) {
+				ng.Trigrams[strings.Join(chain[i:i+3], " ")]++
+			}
+		}
+	}
+}
+
+// adds the n-grams of other (e.g. of an archive)
+func (ng *NGrams) Merge(other *NGrams) {
+	ng.Chains += other.Chains
+	for length, count := range other.Lengths {
+		ng.Lengths[length] += count
+	}
+	for bigram, count := range other.Bigrams {
+		ng.Bigrams[bigram] += count
+	}
+	for trigram, count := range other.Trigrams {
+		ng.Trigrams[trigram] += count
+	}
+}
+
+// returns the n-grams sorted by their frequency (descending) and then by their names
+func sortNGrams(ngrams map[string]int) []NGramCount {
+	sorted := make([]NGramCount, 0, len(ngrams))
+	for ngram, count := range ngrams {
+		sorted = append(sorted, NGramCount{strings.Split(ngram, " "), count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return strings.Join(sorted[i].NGram, " ") < strings.Join(sorted[j].NGram, " ")
+	})
+	return sorted
+}
+
+func (ng *NGrams) Result() *NGramsResult {
+	return &NGramsResult{Chains: ng.Chains, Lengths: ng.Lengths,
+		Bigrams: sortNGrams(ng.Bigrams), Trigrams: sortNGrams(ng.Trigrams)}
+}
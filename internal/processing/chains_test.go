@@ -0,0 +1,58 @@
+package processing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractChains(t *testing.T) {
+	operators := []string{"map", "filter", "subscribe", "tap", "switchMap", "of"}
+	tests := []struct {
+		name, content string
+		want          [][]string
+	}{
+		{"dot chaining", "obs.map(x => x).filter(f).subscribe()", [][]string{{"map", "filter", "subscribe"}}},
+		{"pipe arguments", "obs.pipe(\n  map(f),\n  filter(g)\n).subscribe()", [][]string{{"map", "filter", "subscribe"}}},
+		{"standalone pipe", "const p = pipe(filter(f), map(g));", [][]string{{"filter", "map"}}},
+		{"other links", "obs.map(f).rx.tap(g).toList().subscribe()", [][]string{{"map", "tap", "subscribe"}}},
+		{"trailing closures", "obs.map { $0 }\n  .filter { $0 > 1 }\n  .subscribe(onNext: { print($0) }) { }", [][]string{{"map", "filter", "subscribe"}}},
+		{"safe calls", "obs?.map(f)!!.filter(g)", [][]string{{"map", "filter"}}},
+		{"type witnesses", "obs.<String>map(f).filter(g)", [][]string{{"map", "filter"}}},
+		{"statements", "a.map(f);\nb.filter(g)", [][]string{{"map"}, {"filter"}}},
+		{"nested chains", "obs.switchMap(x => of(x).map(f)).tap(g)", [][]string{{"switchMap", "tap"}, {"of", "map"}}},
+		{"no operators", "const a = b.c(d);", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offsets := make([][]int, len(operators))
+			for i, op := range operators {
+				offsets[i] = findCalls(tt.content, op)
+			}
+			if got := extractChains(tt.content, offsets, operators); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractChains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNGrams(t *testing.T) {
+	ng := NewNGrams()
+	ng.Add([][]string{{"of", "map", "filter", "subscribe"}, {"map", "filter"}})
+	other := NewNGrams()
+	other.Add([][]string{{"subscribe"}})
+	ng.Merge(other)
+
+	want := &NGramsResult{Chains: 3, Lengths: map[int]int{1: 1, 2: 1, 4: 1},
+		Bigrams: []NGramCount{
+			{[]string{"map", "filter"}, 2},
+			{[]string{"filter", "subscribe"}, 1},
+			{[]string{"of", "map"}, 1},
+		},
+		Trigrams: []NGramCount{
+			{[]string{"map", "filter", "subscribe"}, 1},
+			{[]string{"of", "map", "filter"}, 1},
+		}}
+	if got := ng.Result(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Result = %+v, want %+v", got, want)
+	}
+}
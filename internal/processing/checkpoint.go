@@ -0,0 +1,297 @@
+package processing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/iancoleman/orderedmap"
+)
+
+// results of an archive as stored in the checkpoint; archives whose reading
+// failed are stored with their error (quarantined) and no counts
+// when several distributions are searched, an archive has an entry per distribution
+// and only the first one holds the versions and exclusions, shared by all of them
+type ArchiveCheckpoint struct {
+	Archive       string                    `json:"archive"`
+	Distribution  string                    `json:"distribution,omitempty"`
+	Error         string                    `json:"error,omitempty"`
+	Files         int                       `json:"files"`
+	Counts        map[string]int            `json:"counts,omitempty"`
+	CountsByClass map[string]map[string]int `json:"countsByClass,omitempty"`
+	// missing from checkpoints written before languages were recorded
+	CountsByLanguage map[string]map[string]int `json:"countsByLanguage,omitempty"`
+	Versions         []types.RxVersion         `json:"versions,omitempty"`
+	Excluded         map[string]int            `json:"excluded,omitempty"`
+	// only stored when chains, co-occurrences or co-imports are reported
+	NGrams       *NGrams              `json:"ngrams,omitempty"`
+	CoOccurrence *ArchiveCoOccurrence `json:"cooccurrence,omitempty"`
+	CoImports    *ArchiveCoImports    `json:"coImports,omitempty"`
+}
+
+// append-only store (NDJSON) of the archives finished by operator-search
+// each archive is written (and synced) as soon as all of its files are counted,
+// so a run can be resumed from where it stopped
+type Checkpoint struct {
+	file *os.File
+	// archives finished or quarantined -> their entries
+	Archives map[string][]*ArchiveCheckpoint
+}
+
+// opens the checkpoint at path, loading the archives stored by previous runs
+// unless fresh is set; an incomplete last line (e.g. from a crash) is discarded
+func OpenCheckpoint(path string, fresh bool) (*Checkpoint, error) {
+	cp := &Checkpoint{Archives: make(map[string][]*ArchiveCheckpoint)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	valid := 0
+	if !fresh {
+		for valid < len(data) {
+			end := bytes.IndexByte(data[valid:], '\n')
+			if end < 0 {
+				break
+			}
+			var entry ArchiveCheckpoint
+			if err := json.Unmarshal(data[valid:valid+end], &entry); err != nil {
+				break
+			}
+			cp.Archives[entry.Archive] = append(cp.Archives[entry.Archive], &entry)
+			valid += end + 1
+		}
+		if valid < len(data) {
+			log.Printf("Discarding %d byte(s) of an incomplete entry at the end of %s", len(data)-valid, path)
+		}
+	}
+
+	cp.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := cp.file.Truncate(int64(valid)); err != nil {
+		return nil, err
+	}
+	if _, err := cp.file.Seek(int64(valid), 0); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// indicates if the archive was finished or quarantined, by this run or a previous one
+func (cp *Checkpoint) Done(archive string) bool {
+	_, ok := cp.Archives[archive]
+	return ok
+}
+
+// indicates if archives were loaded from previous runs
+func (cp *Checkpoint) Resumed() bool {
+	return len(cp.Archives) > 0
+}
+
+// appends the entries of an archive in a single write, so they are all stored or none
+func (cp *Checkpoint) Append(entries ...*ArchiveCheckpoint) error {
+	var lines []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if _, err := cp.file.Write(lines); err != nil {
+		return err
+	}
+	if err := cp.file.Sync(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		cp.Archives[entry.Archive] = append(cp.Archives[entry.Archive], entry)
+	}
+	return nil
+}
+
+func (cp *Checkpoint) Close() error {
+	return cp.file.Close()
+}
+
+// fills the results, versions and exclusions in with the archives of previous runs
+func (cp *Checkpoint) Restore(run *RunResults) error {
+	for _, k := range run.Archives() {
+		for _, entry := range cp.Archives[k] {
+			if entry.Error != "" {
+				run.Quarantined[k] = entry.Error
+				continue
+			}
+			dist := entry.Distribution
+			if dist == "" && len(run.Order) == 1 {
+				dist = run.Order[0]
+			}
+			_, ok := run.Distributions[dist]
+			if !ok {
+				return fmt.Errorf("distribution %q not searched in the checkpoint of %s: run it with a fresh checkpoint",
+					entry.Distribution, k)
+			}
+			if err := restoreArchive(run, dist, k, entry); err != nil {
+				return fmt.Errorf("%s in the checkpoint of %s: run it with a fresh checkpoint", err, k)
+			}
+			run.Versions.Add(k, entry.Versions...)
+			run.Exclusions.AddArchive(k, entry.Excluded)
+		}
+	}
+	return nil
+}
+
+func restoreArchive(run *RunResults, dist, archive string, entry *ArchiveCheckpoint) error {
+	results := run.Distributions[dist]
+	v, _ := results.Counts.Get(archive)
+	mapEntry := v.(*orderedmap.OrderedMap)
+	if err := restoreCounts(mapEntry, entry.Counts); err != nil {
+		return err
+	}
+	if err := restoreBreakdown(results.CountsByClass, archive, entry.CountsByClass, mapEntry.Keys()); err != nil {
+		return err
+	}
+	if err := restoreBreakdown(results.CountsByLanguage, archive, entry.CountsByLanguage, mapEntry.Keys()); err != nil {
+		return err
+	}
+	// the archive was searched without reporting them
+	if results.NGrams != nil {
+		if entry.NGrams == nil {
+			return errors.New("no chains recorded")
+		}
+		results.NGrams.Merge(entry.NGrams)
+	}
+	if results.CoOccurrences != nil {
+		if entry.CoOccurrence == nil {
+			return errors.New("no co-occurrences recorded")
+		}
+		if err := results.CoOccurrences.AddArchive(archive, entry.CoOccurrence); err != nil {
+			return err
+		}
+	}
+	if run.CoImports != nil {
+		if entry.CoImports == nil {
+			return errors.New("no co-imports recorded")
+		}
+		return run.CoImports.AddArchive(dist, entry.CoImports)
+	}
+	return nil
+}
+
+func restoreBreakdown(breakdown *orderedmap.OrderedMap, archive string, counts map[string]map[string]int,
+	operators []string) error {
+	for class, classCounts := range counts {
+		if err := restoreCounts(getClassEntry(breakdown, archive, class, operators), classCounts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreCounts(entry *orderedmap.OrderedMap, counts map[string]int) error {
+	for op, count := range counts {
+		if _, ok := entry.Get(op); !ok {
+			return fmt.Errorf("unknown operator %s", op)
+		}
+		entry.Set(op, count)
+	}
+	return nil
+}
+
+// creates the checkpoint entries of an archive from the results of each distribution
+func archiveCheckpoints(run *RunResults, archive string, files int) []*ArchiveCheckpoint {
+	entries := make([]*ArchiveCheckpoint, 0, len(run.Order))
+	for i, dist := range run.Order {
+		results := run.Distributions[dist]
+		entry := archiveCheckpoint(results, archive, files)
+		if len(run.Order) > 1 {
+			entry.Distribution = dist
+		}
+		if results.NGrams != nil {
+			entry.NGrams = results.archiveNGrams(archive)
+		}
+		if results.CoOccurrences != nil {
+			entry.CoOccurrence = results.CoOccurrences.Archive(archive)
+		}
+		if run.CoImports != nil {
+			entry.CoImports = run.CoImports.Archive(archive, dist)
+		}
+		if i == 0 {
+			entry.Versions, entry.Excluded = run.Versions.Archive(archive), run.Exclusions.Archive(archive)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func archiveCheckpoint(results *Results, archive string, files int) *ArchiveCheckpoint {
+	entry := &ArchiveCheckpoint{Archive: archive, Files: files, Counts: make(map[string]int),
+		CountsByClass:    breakdownCheckpoint(results.CountsByClass, archive),
+		CountsByLanguage: breakdownCheckpoint(results.CountsByLanguage, archive)}
+	v, _ := results.Counts.Get(archive)
+	mapEntry := v.(*orderedmap.OrderedMap)
+	for _, op := range mapEntry.Keys() {
+		if v, _ := mapEntry.Get(op); v.(int) > 0 {
+			entry.Counts[op] = v.(int)
+		}
+	}
+	return entry
+}
+
+// returns the counts of the archive split by class (or language), leaving zeros out
+func breakdownCheckpoint(breakdown *orderedmap.OrderedMap, archive string) map[string]map[string]int {
+	counts := make(map[string]map[string]int)
+	if v, ok := breakdown.Get(archive); ok {
+		archiveEntry := v.(*orderedmap.OrderedMap)
+		for _, class := range archiveEntry.Keys() {
+			v, _ := archiveEntry.Get(class)
+			classEntry := v.(*orderedmap.OrderedMap)
+			classCounts := make(map[string]int)
+			for _, op := range classEntry.Keys() {
+				if v, _ := classEntry.Get(op); v.(int) > 0 {
+					classCounts[op] = v.(int)
+				}
+			}
+			counts[class] = classCounts
+		}
+	}
+	return counts
+}
+
+// discards what was counted for an archive whose reading failed
+func quarantine(run *RunResults, archive string, err error) {
+	log.Printf("Quarantining %s: %v", archive, err)
+	run.Quarantined[archive] = err.Error()
+	discard(run, archive)
+}
+
+// discards what was counted for an archive interrupted by a cancellation; unlike
+// quarantined archives, it isn't checkpointed, so it's searched again when resuming
+func interrupt(run *RunResults, archive string) {
+	run.Interrupted = append(run.Interrupted, archive)
+	discard(run, archive)
+}
+
+func discard(run *RunResults, archive string) {
+	for _, results := range run.Distributions {
+		v, _ := results.Counts.Get(archive)
+		mapEntry := v.(*orderedmap.OrderedMap)
+		for _, op := range mapEntry.Keys() {
+			mapEntry.Set(op, 0)
+		}
+		results.CountsByClass.Delete(archive)
+		results.CountsByLanguage.Delete(archive)
+		results.drop(archive)
+	}
+	run.Versions.Remove(archive)
+	run.Exclusions.Remove(archive)
+	if run.CoImports != nil {
+		run.CoImports.Remove(archive)
+	}
+}
@@ -0,0 +1,66 @@
+package processing
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/types"
+)
+
+// classes of files regarding where the operators are used
+const (
+	TEST_CLASS       = "test"
+	PRODUCTION_CLASS = "production"
+	SAMPLE_CLASS     = "sample"
+)
+
+var FileClasses = []string{PRODUCTION_CLASS, TEST_CLASS, SAMPLE_CLASS}
+
+var (
+	// folders of tests in Java/Kotlin, JS/TS and Swift projects
+	testDirReg = regexp.MustCompile(`(?i)(^|/)(tests?|__tests__|__mocks__|spec|specs|e2e|testing|androidTest|testFixtures|integrationTest)/`)
+	// test targets (e.g. AppTests/, AppUITests/) and test file names
+	testNameReg = regexp.MustCompile(`(^|/)\w*Tests/` +
+		`|(Test|Tests|TestCase|Spec|[a-z0-9]IT)\.(java|kt|kts|swift)$` +
+		`|(^|/)Test[A-Z]\w*\.(java|kt)$` +
+		`|[._-](test|spec|e2e|stories)\.(js|jsx|mjs|cjs|ts|tsx)$` +
+		`|_test\.\w+$`)
+	sampleDirReg  = regexp.MustCompile(`(?i)(^|/)(samples?|examples?|demos?|playgrounds?|tutorials?|sandbox|showcase)/|\.playground/`)
+	sampleNameReg = regexp.MustCompile(`(^|/)\w*(Example|Sample|Demo)s?/`)
+)
+
+// modules of test frameworks and test utilities, including the Rx ones
+var testModules = []string{
+	// Java and Kotlin
+	"org.junit", "junit.framework", "org.testng", "org.mockito", "org.assertj", "org.hamcrest",
+	"io.kotest", "org.spekframework", "kotlin.test", "io.mockk", "org.robolectric", "androidx.test",
+	"io.reactivex.observers.TestObserver", "io.reactivex.subscribers.TestSubscriber",
+	"io.reactivex.schedulers.TestScheduler", "io.reactivex.rxjava3.observers.TestObserver",
+	"io.reactivex.rxjava3.subscribers.TestSubscriber", "io.reactivex.rxjava3.schedulers.TestScheduler",
+	"rx.observers.TestSubscriber", "rx.schedulers.TestScheduler",
+	// JS and TS
+	"jasmine", "jest", "@jest", "mocha", "chai", "sinon", "ava", "tape", "vitest", "cypress",
+	"@testing-library", "@angular/core/testing", "@ngrx/effects/testing", "@ngrx/store/testing",
+	"rxjs/testing", "jasmine-marbles", "rxjs-marbles", "jest-marbles", "@nestjs/testing",
+	// Swift
+	"XCTest", "RxTest", "RxBlocking", "Quick", "Nimble",
+}
+
+// classifies a file as test, sample or production code by its path and imports
+func classifyFile(filePath string, imports []types.Import) string {
+	if testDirReg.MatchString(filePath) || testNameReg.MatchString(filePath) {
+		return TEST_CLASS
+	}
+	if sampleDirReg.MatchString(filePath) || sampleNameReg.MatchString(filePath) {
+		return SAMPLE_CLASS
+	}
+	for _, imp := range imports {
+		for _, module := range testModules {
+			if imp.Module == module || strings.HasPrefix(imp.Module, module+".") ||
+				strings.HasPrefix(imp.Module, module+"/") {
+				return TEST_CLASS
+			}
+		}
+	}
+	return PRODUCTION_CLASS
+}
@@ -0,0 +1,46 @@
+package processing
+
+import (
+	"testing"
+
+	"github.com/carloszimm/github-mining/internal/types"
+)
+
+func TestClassifyFile(t *testing.T) {
+	tests := []struct {
+		file    string
+		imports []string
+		want    string
+	}{
+		{"app/src/main/java/com/acme/Repository.java", nil, PRODUCTION_CLASS},
+		{"app/src/test/java/com/acme/RepositoryTest.java", nil, TEST_CLASS},
+		{"app/src/androidTest/java/com/acme/Screen.kt", nil, TEST_CLASS},
+		{"lib/src/main/java/com/acme/StreamIT.java", nil, TEST_CLASS},
+		{"lib/src/main/java/com/acme/TestUtils.java", nil, TEST_CLASS},
+		{"src/app/user.service.spec.ts", nil, TEST_CLASS},
+		{"src/components/__tests__/list.js", nil, TEST_CLASS},
+		{"src/button.stories.tsx", nil, TEST_CLASS},
+		{"AppTests/ViewModelTests.swift", nil, TEST_CLASS},
+		{"examples/basic/index.js", nil, SAMPLE_CLASS},
+		{"RxExample/Sources/Main.swift", nil, SAMPLE_CLASS},
+		{"Intro.playground/Contents.swift", nil, SAMPLE_CLASS},
+		// tests of the samples are tests
+		{"samples/app/src/test/AppTest.kt", nil, TEST_CLASS},
+		// files of tests found by their imports only
+		{"src/app/helpers.ts", []string{"rxjs/testing"}, TEST_CLASS},
+		{"src/main/kotlin/Fixtures.kt", []string{"io.reactivex.observers.TestObserver"}, TEST_CLASS},
+		{"Sources/Helpers.swift", []string{"RxSwift", "RxBlocking"}, TEST_CLASS},
+		// modules only sharing a prefix with the test ones
+		{"src/app/jest-config-helper.ts", []string{"jestful", "rxjs/testingtools"}, PRODUCTION_CLASS},
+		{"src/latest/contest.ts", nil, PRODUCTION_CLASS},
+	}
+	for _, tt := range tests {
+		var imports []types.Import
+		for _, module := range tt.imports {
+			imports = append(imports, types.Import{Module: module})
+		}
+		if got := classifyFile(tt.file, imports); got != tt.want {
+			t.Errorf("classifyFile(%q, %v) = %s, want %s", tt.file, tt.imports, got, tt.want)
+		}
+	}
+}
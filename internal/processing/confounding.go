@@ -0,0 +1,247 @@
+package processing
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// confounding libraries of each distribution (lowercase) unless the configuration declares them
+var DefaultConfoundingLibraries = map[string][]config.ConfoundingLibrary{
+	"rxjava": {
+		{Name: "Stream", Imports: []string{`^java\.util\.stream\b`}},
+		{Name: "Eclipse", Imports: []string{`^org\.eclipse\.collections\b`}},
+		{Name: "CollectionUtils", Imports: []string{`^org\.apache\.commons\.collections4\.CollectionUtils\b`}},
+		{Name: "Guava", Imports: []string{`^com\.google\.common\.collect\.Collections2\b`, `^com\.google\.guava\b`}},
+	},
+	"rxkotlin": {
+		{Name: "Kotlin collections", Imports: []string{`^kotlin\.collections\b`, `^kotlin\.sequences\b`}},
+		{Name: "Stream", Imports: []string{`^java\.util\.stream\b`}},
+	},
+	// Array methods are built-in, so they can't be told apart by imports
+	"rxjs": {
+		{Name: "lodash", Imports: []string{`^lodash(-es)?([./]|$)`}},
+		{Name: "Ramda", Imports: []string{`^ramda(/|$)`}},
+		{Name: "Immutable", Imports: []string{`^immutable$`}},
+		{Name: "IxJS", Imports: []string{`^(ix|@reactivex/ix-\w+)(/|$)`}},
+	},
+	"rxswift": {
+		{Name: "Combine", Imports: []string{`^Combine$`}},
+		{Name: "Swift Collections", Imports: []string{`^(Collections|OrderedCollections|DequeModule)$`}},
+		{Name: "Swift Algorithms", Imports: []string{`^Algorithms$`}},
+	},
+}
+
+// confounding library with its import patterns compiled
+type ConfoundingLib struct {
+	Name    string
+	imports []*regexp.Regexp
+}
+
+// returns the confounding libraries of the distribution: the ones declared in the
+// configuration (keys are case insensitive) or else the default ones
+func ConfoundingLibraries(cfg *config.Config, dist string) ([]*ConfoundingLib, error) {
+	libraries, ok := DefaultConfoundingLibraries[strings.ToLower(dist)]
+	for d, libs := range cfg.ConfoundingLibraries {
+		if strings.EqualFold(d, dist) {
+			libraries, ok = libs, true
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	var compiled []*ConfoundingLib
+	for _, lib := range libraries {
+		if lib.Name == "" || len(lib.Imports) == 0 {
+			return nil, fmt.Errorf("confounding library of %s without a name or imports: %+v", dist, lib)
+		}
+		cl := &ConfoundingLib{Name: lib.Name}
+		for _, expr := range lib.Imports {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("imports of the confounding library %s: %v", lib.Name, err)
+			}
+			cl.imports = append(cl.imports, re)
+		}
+		compiled = append(compiled, cl)
+	}
+	return compiled, nil
+}
+
+// indicates if any of the imports is of the library
+func (cl *ConfoundingLib) Imported(imports []types.Import) bool {
+	for _, imp := range imports {
+		for _, re := range cl.imports {
+			if re.MatchString(imp.Module) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// files importing a confounding library along with the distribution
+type LibraryCoImports struct {
+	Files int      `json:"files"`
+	Paths []string `json:"paths"`
+}
+
+type DistributionCoImports struct {
+	// files importing the distribution
+	Files int `json:"files"`
+	// files importing the distribution and any of its confounding libraries
+	CoImported int                          `json:"coImported"`
+	Libraries  map[string]*LibraryCoImports `json:"libraries"`
+	libraries  []*ConfoundingLib
+}
+
+// files of an archive importing a distribution, as stored in the checkpoint
+type ArchiveCoImports struct {
+	Files      int `json:"files"`
+	CoImported int `json:"coImported,omitempty"`
+	// confounding library -> paths of the files importing it
+	Libraries map[string][]string `json:"libraries,omitempty"`
+}
+
+// report of the files importing confounding libraries along with each distribution,
+// the ones worth inspecting for false positives
+type CoImportReport struct {
+	mu            sync.Mutex
+	Distributions map[string]*DistributionCoImports `json:"distributions"`
+	// archive -> distribution -> files added, until the archive is finished
+	pending map[string]map[string]*ArchiveCoImports
+}
+
+func NewCoImportReport(cfg *config.Config, dists []string) (*CoImportReport, error) {
+	report := &CoImportReport{Distributions: make(map[string]*DistributionCoImports),
+		pending: make(map[string]map[string]*ArchiveCoImports)}
+	for _, dist := range dists {
+		libraries, err := ConfoundingLibraries(cfg, dist)
+		if err != nil {
+			return nil, err
+		}
+		entry := &DistributionCoImports{Libraries: make(map[string]*LibraryCoImports), libraries: libraries}
+		for _, lib := range libraries {
+			entry.Libraries[lib.Name] = &LibraryCoImports{Paths: []string{}}
+		}
+		report.Distributions[dist] = entry
+	}
+	return report, nil
+}
+
+// adds a file importing the distribution; it's only reported once its archive is committed
+func (r *CoImportReport) Add(dist string, t *types.ContentMsg) {
+	var imported []string
+	for _, lib := range r.Distributions[dist].libraries {
+		if lib.Imported(t.Imports) {
+			imported = append(imported, lib.Name)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := r.archive(t.FileName, dist)
+	entry.Files++
+	if len(imported) > 0 {
+		entry.CoImported++
+	}
+	for _, name := range imported {
+		entry.Libraries[name] = append(entry.Libraries[name], t.InnerFileName)
+	}
+}
+
+func (r *CoImportReport) archive(archive, dist string) *ArchiveCoImports {
+	dists, ok := r.pending[archive]
+	if !ok {
+		dists = make(map[string]*ArchiveCoImports)
+		r.pending[archive] = dists
+	}
+	entry, ok := dists[dist]
+	if !ok {
+		entry = &ArchiveCoImports{Libraries: make(map[string][]string)}
+		dists[dist] = entry
+	}
+	return entry
+}
+
+// returns the files of an archive not committed yet that import the distribution
+func (r *CoImportReport) Archive(archive, dist string) *ArchiveCoImports {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.pending[archive][dist]; ok {
+		return entry
+	}
+	return &ArchiveCoImports{}
+}
+
+// adds the files of a finished archive to the report
+func (r *CoImportReport) Commit(archive string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for dist, entry := range r.pending[archive] {
+		r.add(dist, entry)
+	}
+	delete(r.pending, archive)
+}
+
+// adds the files of an archive finished by a previous run (from the checkpoint)
+func (r *CoImportReport) AddArchive(dist string, entry *ArchiveCoImports) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range entry.Libraries {
+		if _, ok := r.Distributions[dist].Libraries[name]; !ok {
+			return fmt.Errorf("unknown confounding library %s", name)
+		}
+	}
+	r.add(dist, entry)
+	return nil
+}
+
+func (r *CoImportReport) add(dist string, entry *ArchiveCoImports) {
+	report := r.Distributions[dist]
+	report.Files += entry.Files
+	report.CoImported += entry.CoImported
+	for name, paths := range entry.Libraries {
+		lib := report.Libraries[name]
+		lib.Files += len(paths)
+		lib.Paths = append(lib.Paths, paths...)
+	}
+}
+
+// drops the files of an archive that won't be finished
+func (r *CoImportReport) Remove(archive string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, archive)
+}
+
+// returns the number of files per library of each distribution
+func (r *CoImportReport) Totals() map[string]map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make(map[string]map[string]int)
+	for dist, entry := range r.Distributions {
+		totals[dist] = make(map[string]int)
+		for name, lib := range entry.Libraries {
+			totals[dist][name] = lib.Files
+		}
+	}
+	return totals
+}
+
+func (r *CoImportReport) Write(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, entry := range r.Distributions {
+		for _, lib := range entry.Libraries {
+			sort.Strings(lib.Paths)
+		}
+	}
+	return util.WritePrettyJSON(path, r)
+}
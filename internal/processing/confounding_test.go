@@ -0,0 +1,124 @@
+package processing
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/types"
+)
+
+func importsOf(modules ...string) []types.Import {
+	var imps []types.Import
+	for _, module := range modules {
+		imps = append(imps, types.Import{Module: module})
+	}
+	return imps
+}
+
+func TestConfoundingLibraries(t *testing.T) {
+	libraryNames := func(libs []*ConfoundingLib) []string {
+		var names []string
+		for _, lib := range libs {
+			names = append(names, lib.Name)
+		}
+		return names
+	}
+	cfg := &config.Config{ConfoundingLibraries: map[string][]config.ConfoundingLibrary{
+		"rxjs": {{Name: "Highland", Imports: []string{`^highland$`}}},
+	}}
+	tests := []struct {
+		dist string
+		want []string
+	}{
+		{"RxJava", []string{"Stream", "Eclipse", "CollectionUtils", "Guava"}},
+		// the configured libraries replace the default ones
+		{"RxJS", []string{"Highland"}},
+		{"RxPY", nil},
+	}
+	for _, tt := range tests {
+		libs, err := ConfoundingLibraries(cfg, tt.dist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := libraryNames(libs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ConfoundingLibraries(%s) = %v, want %v", tt.dist, got, tt.want)
+		}
+	}
+
+	for _, lib := range []config.ConfoundingLibrary{{Name: "Broken", Imports: []string{`(`}}, {Name: "Empty"}} {
+		cfg := &config.Config{ConfoundingLibraries: map[string][]config.ConfoundingLibrary{"RxJava": {lib}}}
+		if _, err := ConfoundingLibraries(cfg, "RxJava"); err == nil {
+			t.Errorf("ConfoundingLibraries with %+v succeeded", lib)
+		}
+	}
+}
+
+func TestConfoundingLibImported(t *testing.T) {
+	libs, err := ConfoundingLibraries(&config.Config{}, "RxJS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		imports []types.Import
+		want    []string
+	}{
+		{importsOf("rxjs", "lodash/map"), []string{"lodash"}},
+		{importsOf("lodash-es"), []string{"lodash"}},
+		{importsOf("lodash.debounce", "ramda"), []string{"lodash", "Ramda"}},
+		{importsOf("@reactivex/ix-es2015/iterable"), []string{"IxJS"}},
+		// modules only sharing a prefix with the libraries
+		{importsOf("lodashy", "ramda-adjunct", "immutable-js", "ixjs"), nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, lib := range libs {
+			if lib.Imported(tt.imports) {
+				got = append(got, lib.Name)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("imported by %v = %v, want %v", tt.imports, got, tt.want)
+		}
+	}
+}
+
+func TestCoImportReport(t *testing.T) {
+	report, err := NewCoImportReport(&config.Config{}, []string{"RxJava"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := func(archive, name string, modules ...string) *types.ContentMsg {
+		return &types.ContentMsg{FileName: archive, InnerFileName: name, Imports: importsOf(modules...)}
+	}
+	report.Add("RxJava", file("a", "a/A.java", "io.reactivex.Observable", "java.util.stream.Collectors"))
+	report.Add("RxJava", file("a", "a/B.java", "io.reactivex.Observable"))
+	report.Add("RxJava", file("b", "b/C.java", "io.reactivex.Flowable", "com.google.common.collect.Collections2"))
+	// archive interrupted before it is finished
+	report.Add("RxJava", file("c", "c/D.java", "io.reactivex.Single", "java.util.stream.Stream"))
+	checkpointed := report.Archive("b", "RxJava")
+	report.Commit("a")
+	report.Remove("c")
+
+	// b is restored from the checkpoint instead
+	if err := report.AddArchive("RxJava", checkpointed); err != nil {
+		t.Fatal(err)
+	}
+	entry := report.Distributions["RxJava"]
+	if entry.Files != 3 || entry.CoImported != 2 {
+		t.Errorf("files = %d, co-imported = %d, want 3 and 2", entry.Files, entry.CoImported)
+	}
+	want := map[string]int{"Stream": 1, "Eclipse": 0, "CollectionUtils": 0, "Guava": 1}
+	if got := report.Totals()["RxJava"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Totals = %v, want %v", got, want)
+	}
+	if paths := entry.Libraries["Stream"].Paths; !reflect.DeepEqual(paths, []string{"a/A.java"}) {
+		t.Errorf("Stream paths = %v", paths)
+	}
+
+	err = report.AddArchive("RxJava", &ArchiveCoImports{Files: 1, Libraries: map[string][]string{"Vavr": {"d/E.java"}}})
+	if err == nil || !strings.Contains(err.Error(), "Vavr") {
+		t.Errorf("AddArchive of an unknown library = %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package processing
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// operator x operator co-occurrence matrix over a set of units (files or repositories)
+// two operators co-occur in a unit when both are used at least once in it
+type CoOccurrence struct {
+	operators []string
+	units     int
+	// number of units using each operator
+	counts []int
+	// number of units using both operators (i < j)
+	pairs map[[2]int]int
+}
+
+func NewCoOccurrence(operators []string) *CoOccurrence {
+	return &CoOccurrence{operators: operators, counts: make([]int, len(operators)),
+		pairs: make(map[[2]int]int)}
+}
+
+// adds a unit given the indexes (ascending) of the operators used in it
+func (co *CoOccurrence) Add(used []int) {
+	co.units++
+	for i, a := range used {
+		co.counts[a]++
+		for _, b := range used[i+1:] {
+			co.pairs[[2]int{a, b}]++
+		}
+	}
+}
+
+// adds the units of other, over the same operators
+func (co *CoOccurrence) merge(other *CoOccurrence) {
+	co.units += other.units
+	for i, count := range other.counts {
+		co.counts[i] += count
+	}
+	for pair, count := range other.pairs {
+		co.pairs[pair] += count
+	}
+}
+
+// indexes of the operators used in any unit
+func (co *CoOccurrence) used() []int {
+	var used []int
+	for i, count := range co.counts {
+		if count > 0 {
+			used = append(used, i)
+		}
+	}
+	return used
+}
+
+// type to store the co-occurrence of a pair of operators and its association scores
+// lift = P(a,b) / (P(a) * P(b)) and PMI = log2(lift)
+type CoOccurrencePair struct {
+	A     string  `json:"a"`
+	B     string  `json:"b"`
+	Count int     `json:"count"`
+	Lift  float64 `json:"lift"`
+	PMI   float64 `json:"pmi"`
+}
+
+// sparse representation of the matrix: only operators used and pairs that co-occur
+type SparseCoOccurrence struct {
+	Units     int                `json:"units"`
+	Operators map[string]int     `json:"operators"`
+	Pairs     []CoOccurrencePair `json:"pairs"`
+}
+
+func (co *CoOccurrence) lift(a, b, count int) float64 {
+	return float64(count) * float64(co.units) / (float64(co.counts[a]) * float64(co.counts[b]))
+}
+
+// returns the pairs sorted by their count (descending) and then by their names
+func (co *CoOccurrence) Sparse() *SparseCoOccurrence {
+	sparse := &SparseCoOccurrence{Units: co.units, Operators: make(map[string]int),
+		Pairs: make([]CoOccurrencePair, 0, len(co.pairs))}
+	for i, count := range co.counts {
+		if count > 0 {
+			sparse.Operators[co.operators[i]] = count
+		}
+	}
+	for pair, count := range co.pairs {
+		lift := co.lift(pair[0], pair[1], count)
+		sparse.Pairs = append(sparse.Pairs, CoOccurrencePair{A: co.operators[pair[0]],
+			B: co.operators[pair[1]], Count: count, Lift: lift, PMI: math.Log2(lift)})
+	}
+	sort.Slice(sparse.Pairs, func(i, j int) bool {
+		p, q := sparse.Pairs[i], sparse.Pairs[j]
+		if p.Count != q.Count {
+			return p.Count > q.Count
+		}
+		if p.A != q.A {
+			return p.A < q.A
+		}
+		return p.B < q.B
+	})
+	return sparse
+}
+
+// writes the symmetric matrix of the operators used at least once; score selects the cell
+// value: count, lift or pmi. The diagonal holds the number of units using the operator in
+// the count matrix and is left empty in the others, as an operator always co-occurs with itself
+func (co *CoOccurrence) WriteCSV(path, score string) error {
+	f, err := os.Create(path + ".csv")
+	if err != nil {
+		return err
+	}
+	if err := co.writeRows(csv.NewWriter(f), score); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (co *CoOccurrence) writeRows(w *csv.Writer, score string) error {
+	used := co.used()
+	header := []string{"operator"}
+	for _, op := range used {
+		header = append(header, co.operators[op])
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, a := range used {
+		row := []string{co.operators[a]}
+		for _, b := range used {
+			row = append(row, co.cell(a, b, score))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (co *CoOccurrence) cell(a, b int, score string) string {
+	count := co.counts[a]
+	if a == b && score != "count" {
+		return ""
+	}
+	if a != b {
+		if a > b {
+			a, b = b, a
+		}
+		count = co.pairs[[2]int{a, b}]
+	}
+	if score == "count" {
+		return strconv.Itoa(count)
+	}
+	if count == 0 {
+		// PMI is undefined for pairs that never co-occur
+		return ""
+	}
+	lift := co.lift(a, b, count)
+	if score == "pmi" {
+		lift = math.Log2(lift)
+	}
+	return strconv.FormatFloat(lift, 'f', 4, 64)
+}
+
+// co-occurrences at file and at repository level
+type CoOccurrences struct {
+	Files        *CoOccurrence
+	Repositories *CoOccurrence
+	operators    []string
+	// archive -> co-occurrences of its files, until the archive is finished
+	pending map[string]*CoOccurrence
+}
+
+func NewCoOccurrences(operators []string) *CoOccurrences {
+	return &CoOccurrences{Files: NewCoOccurrence(operators), Repositories: NewCoOccurrence(operators),
+		operators: operators, pending: make(map[string]*CoOccurrence)}
+}
+
+// adds the operators used in a file of the archive, indexed as GetOperators
+func (c *CoOccurrences) AddFile(archive string, used []int) {
+	co, ok := c.pending[archive]
+	if !ok {
+		co = NewCoOccurrence(c.operators)
+		c.pending[archive] = co
+	}
+	co.Add(used)
+}
+
+// adds the files of a finished archive to the matrices; every archive is a unit of the
+// repository level one, even the ones without any operator
+func (c *CoOccurrences) Commit(archive string) {
+	if co, ok := c.pending[archive]; ok {
+		c.Files.merge(co)
+		c.Repositories.Add(co.used())
+		delete(c.pending, archive)
+	} else {
+		c.Repositories.Add(nil)
+	}
+}
+
+// drops the files of an archive that won't be finished
+func (c *CoOccurrences) Remove(archive string) {
+	delete(c.pending, archive)
+}
+
+// co-occurrences of the files of an archive as stored in the checkpoint
+type ArchiveCoOccurrence struct {
+	// files counted and the ones using each operator
+	Files     int            `json:"files"`
+	Operators map[string]int `json:"operators,omitempty"`
+	// pairs of operators ("a b") -> files using both
+	Pairs map[string]int `json:"pairs,omitempty"`
+}
+
+// returns the co-occurrences of an archive not committed yet
+func (c *CoOccurrences) Archive(archive string) *ArchiveCoOccurrence {
+	entry := &ArchiveCoOccurrence{Operators: make(map[string]int), Pairs: make(map[string]int)}
+	co, ok := c.pending[archive]
+	if !ok {
+		return entry
+	}
+	entry.Files = co.units
+	for i, count := range co.counts {
+		if count > 0 {
+			entry.Operators[c.operators[i]] = count
+		}
+	}
+	for pair, count := range co.pairs {
+		entry.Pairs[c.operators[pair[0]]+" "+c.operators[pair[1]]] = count
+	}
+	return entry
+}
+
+// adds the co-occurrences of a finished archive (e.g. from a checkpoint)
+func (c *CoOccurrences) AddArchive(archive string, entry *ArchiveCoOccurrence) error {
+	index := make(map[string]int, len(c.operators))
+	for i, op := range c.operators {
+		index[op] = i
+	}
+	co := NewCoOccurrence(c.operators)
+	co.units = entry.Files
+	for op, count := range entry.Operators {
+		i, ok := index[op]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", op)
+		}
+		co.counts[i] = count
+	}
+	for pair, count := range entry.Pairs {
+		ops := strings.Split(pair, " ")
+		a, okA := index[ops[0]]
+		b, okB := index[ops[len(ops)-1]]
+		if len(ops) != 2 || !okA || !okB {
+			return fmt.Errorf("unknown pair of operators %q", pair)
+		}
+		if a > b {
+			a, b = b, a
+		}
+		co.pairs[[2]int{a, b}] = count
+	}
+	c.pending[archive] = co
+	c.Commit(archive)
+	return nil
+}
+
+// writes <path>_cooccurrence.json (sparse, both levels) and, for each level,
+// the count, lift and PMI matrices as CSV
+func (c *CoOccurrences) Write(path string) error {
+	if err := util.WritePrettyJSON(path+"_cooccurrence", map[string]*SparseCoOccurrence{
+		"files": c.Files.Sparse(), "repositories": c.Repositories.Sparse()}); err != nil {
+		return err
+	}
+	for level, co := range map[string]*CoOccurrence{"files": c.Files, "repositories": c.Repositories} {
+		for _, score := range []string{"count", "lift", "pmi"} {
+			if err := co.WriteCSV(path+"_cooccurrence_"+level+"_"+score, score); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
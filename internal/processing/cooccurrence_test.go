@@ -0,0 +1,102 @@
+package processing
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testCoOccurrences() *CoOccurrences {
+	c := NewCoOccurrences([]string{"map", "filter", "take", "zip"})
+	c.AddFile("x", []int{0, 1})
+	c.AddFile("x", []int{0, 1, 2})
+	c.AddFile("x", nil)
+	c.AddFile("y", []int{1, 2})
+	// an archive interrupted before it is finished
+	c.AddFile("z", []int{0, 3})
+	c.Commit("x")
+	c.Commit("y")
+	c.Remove("z")
+	return c
+}
+
+func TestCoOccurrences(t *testing.T) {
+	c := testCoOccurrences()
+	files := &SparseCoOccurrence{Units: 4, Operators: map[string]int{"map": 2, "filter": 3, "take": 2},
+		Pairs: []CoOccurrencePair{
+			{A: "filter", B: "take", Count: 2, Lift: 4.0 / 3},
+			{A: "map", B: "filter", Count: 2, Lift: 4.0 / 3},
+			{A: "map", B: "take", Count: 1, Lift: 1},
+		}}
+	repositories := &SparseCoOccurrence{Units: 2, Operators: map[string]int{"map": 1, "filter": 2, "take": 2},
+		Pairs: []CoOccurrencePair{
+			{A: "filter", B: "take", Count: 2, Lift: 1},
+			{A: "map", B: "filter", Count: 1, Lift: 1},
+			{A: "map", B: "take", Count: 1, Lift: 1},
+		}}
+	for _, want := range []*SparseCoOccurrence{files, repositories} {
+		for i := range want.Pairs {
+			want.Pairs[i].PMI = math.Log2(want.Pairs[i].Lift)
+		}
+	}
+	if got := c.Files.Sparse(); !reflect.DeepEqual(got, files) {
+		t.Errorf("files = %+v, want %+v", got, files)
+	}
+	if got := c.Repositories.Sparse(); !reflect.DeepEqual(got, repositories) {
+		t.Errorf("repositories = %+v, want %+v", got, repositories)
+	}
+}
+
+func TestCoOccurrencesCheckpoint(t *testing.T) {
+	c := NewCoOccurrences([]string{"map", "filter", "take", "zip"})
+	c.AddFile("x", []int{0, 1})
+	c.AddFile("x", []int{0, 1, 2})
+	c.AddFile("x", nil)
+	c.AddFile("y", []int{1, 2})
+	x, y := c.Archive("x"), c.Archive("y")
+
+	restored := NewCoOccurrences([]string{"map", "filter", "take", "zip"})
+	for archive, entry := range map[string]*ArchiveCoOccurrence{"x": x, "y": y} {
+		if err := restored.AddArchive(archive, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := testCoOccurrences()
+	if !reflect.DeepEqual(restored.Files, want.Files) || !reflect.DeepEqual(restored.Repositories, want.Repositories) {
+		t.Errorf("restored = %+v, %+v, want %+v, %+v", restored.Files, restored.Repositories, want.Files, want.Repositories)
+	}
+	if err := restored.AddArchive("w", &ArchiveCoOccurrence{Files: 1, Operators: map[string]int{"mapTo": 1}}); err == nil {
+		t.Error("AddArchive of an unknown operator succeeded")
+	}
+}
+
+func TestCoOccurrenceWriteCSV(t *testing.T) {
+	c := testCoOccurrences()
+	dir := t.TempDir()
+	tests := []struct {
+		score, want string
+	}{
+		{"count", "operator,map,filter,take\nmap,2,2,1\nfilter,2,3,2\ntake,1,2,2\n"},
+		// the diagonal is left empty
+		{"lift", "operator,map,filter,take\nmap,,1.3333,1.0000\nfilter,1.3333,,1.3333\ntake,1.0000,1.3333,\n"},
+		{"pmi", "operator,map,filter,take\nmap,,0.4150,0.0000\nfilter,0.4150,,0.4150\ntake,0.0000,0.4150,\n"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.score)
+		if err := c.Files.WriteCSV(path, tt.score); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path + ".csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s matrix = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+	if err := c.Files.WriteCSV(filepath.Join(dir, "missing", "count"), "count"); err == nil {
+		t.Error("WriteCSV to a missing folder succeeded")
+	}
+}
@@ -0,0 +1,347 @@
+package processing
+
+import (
+	"bufio"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// categories of files that are not the project's own code
+const (
+	VENDORED     = "vendored"
+	GENERATED    = "generated"
+	MINIFIED     = "minified"
+	BUNDLED_RX   = "bundled-rx"
+	NOT_EXCLUDED = ""
+)
+
+// directories holding third-party code, dependencies or build outputs
+var vendorDirs = map[string]struct{}{
+	"node_modules": {}, "bower_components": {}, "jspm_packages": {}, "web_modules": {},
+	"Pods": {}, "Carthage": {}, ".build": {}, "SourcePackages": {},
+	"vendor": {}, "vendors": {}, "third_party": {}, "third-party": {}, "thirdparty": {},
+	"dist": {}, "build": {}, "out": {}, "target": {}, ".gradle": {}, ".next": {}, ".nuxt": {},
+}
+
+// directories holding a copy of the Rx library itself
+// (RxJava 1's rx package only at a source root or in a copy of RxJava, as projects
+// may have rx.internal-like packages of their own, e.g. com/acme/rx/internal)
+var bundledRxPaths = map[string]*regexp.Regexp{
+	"rxjava":  regexp.MustCompile(`(^|/)io/reactivex/|^((.*/)?(java|rxjava[\w.-]*)/)?rx/(internal|observables|subjects|plugins)/`),
+	"rxjs":    regexp.MustCompile(`(^|/)(rxjs|rxjs-compat|@reactivex/rxjs)/(src|dist|bundles|internal|_esm5|_esm2015|_cjs|add|observable|operator|scheduler|symbol)/`),
+	"rxswift": regexp.MustCompile(`(^|/)(RxSwift|RxCocoa|RxRelay|RxBlocking|RxTest)/(?:Rx|Sources|Platform|Traits|Observables|Subjects)`),
+}
+
+// names of the builds of the Rx library, taken as copies of it only when they are in a
+// library folder, are minified or are module bundles, as projects may name their own files so
+var rxBuildNames = map[string]*regexp.Regexp{
+	"rxjs": regexp.MustCompile(`(?i)^rx(js)?(\.(all|lite|umd|compat|core|aggregates|async|binding|time|virtualtime))*(\.min)?\.js$`),
+}
+
+// folders where libraries are copied to, besides the vendorDirs
+var libDirs = map[string]struct{}{"lib": {}, "libs": {}, "external": {}, "externals": {}}
+
+// markers of module bundles: UMD wrappers and the webpack and SystemJS runtimes
+var bundleReg = regexp.MustCompile(`\bdefine\.amd\b|__webpack_require__|\bSystem\.register\(`)
+
+// names of minified and generated files
+var (
+	minifiedNameReg  = regexp.MustCompile(`[.-]min\.(js|mjs|cjs)$|\.bundle\.js$|\.chunk\.js$`)
+	generatedNameReg = regexp.MustCompile(`(^|/)(Rx)?\w+Grpc\.(java|kt)$|_pb\.(js|d\.ts|ts)$|_grpc_pb\.(js|d\.ts)$|\.pb\.swift$|\.grpc\.swift$|\.g\.dart$|\.generated\.\w+$`)
+)
+
+// markers found in the header (comments) of generated files
+var (
+	generatedHeaderReg     = regexp.MustCompile(`(?i)(code generated\b.*\bdo not edit|@generated\b|do not (edit|modify)\b|auto-?generated|automatically generated|generated by\b)`)
+	generatedAnnotationReg = regexp.MustCompile(`@(javax\.annotation\.(processing\.)?)?Generated\b`)
+	commentLineReg         = regexp.MustCompile(`^\s*(//|/\*|\*|#|<!--)`)
+)
+
+// number of lines inspected when looking for generated headers
+const HEADER_LINES = 15
+
+// a file is considered minified when its lines are, in average, longer than
+// MINIFIED_AVG_LINE or when any of them is longer than MINIFIED_MAX_LINE
+const (
+	MINIFIED_MIN_SIZE = 1024
+	MINIFIED_AVG_LINE = 300
+	MINIFIED_MAX_LINE = 2000
+)
+
+// returns the repository relative path of a tarball entry
+// (GitHub tarballs wrap the repository in a <owner>-<repo>-<sha> folder)
+func repoPath(innerFileName string) string {
+	if i := strings.Index(innerFileName, "/"); i >= 0 {
+		return innerFileName[i+1:]
+	}
+	return innerFileName
+}
+
+// reports whether the file is inside one of the vendorDirs
+func inVendorDir(filePath string) bool {
+	for _, dir := range strings.Split(path.Dir(filePath), "/") {
+		if _, ok := vendorDirs[dir]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether the file is inside one of the vendorDirs or libDirs
+func inLibDir(filePath string) bool {
+	for _, dir := range strings.Split(path.Dir(filePath), "/") {
+		if _, ok := libDirs[dir]; ok {
+			return true
+		}
+	}
+	return inVendorDir(filePath)
+}
+
+// reports whether the file is named like a build of the Rx library
+func isRxBuildName(filePath, dist string) bool {
+	reg, ok := rxBuildNames[strings.ToLower(dist)]
+	return ok && reg.MatchString(path.Base(filePath))
+}
+
+// classifies a file by its path only, so its content doesn't need to be read
+func classifyPath(filePath, dist string, attrs *gitAttributes) string {
+	if vendored, ok := attrs.Get(filePath, "linguist-vendored"); ok {
+		if vendored {
+			return VENDORED
+		}
+	} else if inVendorDir(filePath) {
+		return VENDORED
+	}
+	if reg, ok := bundledRxPaths[strings.ToLower(dist)]; ok && reg.MatchString(filePath) {
+		return BUNDLED_RX
+	}
+	if isRxBuildName(filePath, dist) && (inLibDir(filePath) || minifiedNameReg.MatchString(filePath)) {
+		return BUNDLED_RX
+	}
+	if generated, ok := attrs.Get(filePath, "linguist-generated"); ok {
+		if generated {
+			return GENERATED
+		}
+	} else if generatedNameReg.MatchString(filePath) {
+		return GENERATED
+	}
+	if minifiedNameReg.MatchString(filePath) {
+		return MINIFIED
+	}
+	return NOT_EXCLUDED
+}
+
+// classifies a file by its content (builds of the Rx library, generated headers and minification)
+func classifyContent(filePath, content, dist string, attrs *gitAttributes) string {
+	if isRxBuildName(filePath, dist) && (isMinified(content) || bundleReg.MatchString(content)) {
+		return BUNDLED_RX
+	}
+	if _, ok := attrs.Get(filePath, "linguist-generated"); !ok && hasGeneratedHeader(content) {
+		return GENERATED
+	}
+	if isMinified(content) {
+		return MINIFIED
+	}
+	return NOT_EXCLUDED
+}
+
+func hasGeneratedHeader(content string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(nil, MINIFIED_MAX_LINE)
+	for i := 0; i < HEADER_LINES && scanner.Scan(); i++ {
+		line := scanner.Text()
+		if commentLineReg.MatchString(line) && generatedHeaderReg.MatchString(line) ||
+			generatedAnnotationReg.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMinified(content string) bool {
+	if len(content) < MINIFIED_MIN_SIZE {
+		return false
+	}
+	lines, lineStart := 1, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			if i-lineStart > MINIFIED_MAX_LINE {
+				return true
+			}
+			lines++
+			lineStart = i + 1
+		}
+	}
+	return len(content)-lineStart > MINIFIED_MAX_LINE || len(content)/lines > MINIFIED_AVG_LINE
+}
+
+// linguist overrides declared in .gitattributes files
+// they are read in the order they appear in the tarball, which (as git archive
+// writes trees in sorted order) is before the files of their folder
+type gitAttributes struct {
+	rules []gitAttributesRule
+}
+
+type gitAttributesRule struct {
+	base    string // folder of the .gitattributes file
+	pattern string
+	attr    string
+	value   bool
+}
+
+// parses a .gitattributes file located at filePath and adds its linguist rules
+func (ga *gitAttributes) Parse(filePath, content string) {
+	base := path.Dir(filePath)
+	if base == "." {
+		base = ""
+	}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			attr, value := field, true
+			switch {
+			case strings.HasPrefix(attr, "-") || strings.HasPrefix(attr, "!"):
+				attr, value = attr[1:], false
+			case strings.HasSuffix(attr, "=false"):
+				attr, value = strings.TrimSuffix(attr, "=false"), false
+			case strings.HasSuffix(attr, "=true"):
+				attr = strings.TrimSuffix(attr, "=true")
+			}
+			if attr == "linguist-vendored" || attr == "linguist-generated" {
+				ga.rules = append(ga.rules, gitAttributesRule{base, fields[0], attr, value})
+			}
+		}
+	}
+}
+
+// returns the value of the attribute for the file and if any rule sets it
+// as in git, the last matching rule wins
+func (ga *gitAttributes) Get(filePath, attr string) (value bool, ok bool) {
+	if ga == nil {
+		return false, false
+	}
+	for i := len(ga.rules) - 1; i >= 0; i-- {
+		rule := ga.rules[i]
+		if rule.attr != attr {
+			continue
+		}
+		rel := filePath
+		if rule.base != "" {
+			if !strings.HasPrefix(filePath, rule.base+"/") {
+				continue
+			}
+			rel = filePath[len(rule.base)+1:]
+		}
+		if matchGitPattern(rule.pattern, rel) {
+			return rule.value, true
+		}
+	}
+	return false, false
+}
+
+// matches a path against a gitattributes pattern
+// patterns without a slash match the file name or any of its folders,
+// the others are matched from the .gitattributes folder with ** support
+func matchGitPattern(pattern, rel string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	if !strings.Contains(pattern, "/") {
+		for _, segment := range strings.Split(rel, "/") {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// type to store the number of excluded files per category, overall and per archive
+type ExclusionReport struct {
+	mu       sync.Mutex
+	Totals   map[string]int            `json:"totals"`
+	Archives map[string]map[string]int `json:"archives"`
+}
+
+func NewExclusionReport() *ExclusionReport {
+	return &ExclusionReport{Totals: make(map[string]int), Archives: make(map[string]map[string]int)}
+}
+
+func (er *ExclusionReport) Add(archive, category string) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	er.Totals[category]++
+	if _, ok := er.Archives[archive]; !ok {
+		er.Archives[archive] = make(map[string]int)
+	}
+	er.Archives[archive][category]++
+}
+
+// returns (a copy of) the number of excluded files of an archive per category
+func (er *ExclusionReport) Archive(archive string) map[string]int {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	categories := make(map[string]int)
+	for category, count := range er.Archives[archive] {
+		categories[category] = count
+	}
+	return categories
+}
+
+// adds the number of excluded files of an archive per category (e.g. from a checkpoint)
+func (er *ExclusionReport) AddArchive(archive string, categories map[string]int) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	for category, count := range categories {
+		er.Totals[category] += count
+		if _, ok := er.Archives[archive]; !ok {
+			er.Archives[archive] = make(map[string]int)
+		}
+		er.Archives[archive][category] += count
+	}
+}
+
+func (er *ExclusionReport) Remove(archive string) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	for category, count := range er.Archives[archive] {
+		er.Totals[category] -= count
+	}
+	delete(er.Archives, archive)
+}
+
+func (er *ExclusionReport) Write(path string) error {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	return util.WritePrettyJSON(path, er)
+}
@@ -0,0 +1,114 @@
+package processing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchGitPattern(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		match        bool
+	}{
+		{"*.min.js", "public/js/app.min.js", true},
+		{"*.min.js", "public/js/app.js", false},
+		// patterns without a slash also match folders
+		{"generated", "src/generated/Api.java", true},
+		{"docs/", "docs/a/b.js", true},
+		{"docs/", "src/docs/b.js", false},
+		{"/lib/*.js", "lib/rx.js", true},
+		{"/lib/*.js", "lib/sub/rx.js", false},
+		{"lib/**/*.js", "lib/rx.js", true},
+		{"lib/**/*.js", "lib/a/b/rx.js", true},
+		{"**/vendor/**", "a/vendor/b/c.js", true},
+		{"src/*.ts", "other/src/a.ts", false},
+	}
+	for _, tt := range tests {
+		if got := matchGitPattern(tt.pattern, tt.rel); got != tt.match {
+			t.Errorf("matchGitPattern(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.match)
+		}
+	}
+}
+
+func TestGitAttributes(t *testing.T) {
+	attrs := &gitAttributes{}
+	attrs.Parse(".gitattributes", "# comment\n*.js linguist-vendored\nsrc/** -linguist-vendored\n"+
+		"api/*.ts linguist-generated=true text eol=lf\n")
+	// rules of nested files only apply to their folder and are read after the root ones
+	attrs.Parse("web/.gitattributes", "legacy/*.js linguist-vendored=false\n")
+
+	tests := []struct {
+		file, attr string
+		value, ok  bool
+	}{
+		{"lib/rx.js", "linguist-vendored", true, true},
+		{"src/app.js", "linguist-vendored", false, true},
+		{"src/app.ts", "linguist-vendored", false, true},
+		{"lib/app.ts", "linguist-vendored", false, false},
+		{"api/client.ts", "linguist-generated", true, true},
+		{"lib/api/client.ts", "linguist-generated", false, false},
+		{"web/legacy/a.js", "linguist-vendored", false, true},
+		{"legacy/a.js", "linguist-vendored", true, true},
+	}
+	for _, tt := range tests {
+		if value, ok := attrs.Get(tt.file, tt.attr); value != tt.value || ok != tt.ok {
+			t.Errorf("Get(%q, %q) = %v, %v, want %v, %v", tt.file, tt.attr, value, ok, tt.value, tt.ok)
+		}
+	}
+	var none *gitAttributes
+	if _, ok := none.Get("a.js", "linguist-vendored"); ok {
+		t.Error("Get of no attributes is set")
+	}
+}
+
+func TestClassifyPath(t *testing.T) {
+	tests := []struct {
+		file, dist, want string
+	}{
+		{"app/src/main/java/com/acme/Main.java", "RxJava", NOT_EXCLUDED},
+		{"app/src/main/java/io/reactivex/Observable.java", "RxJava", BUNDLED_RX},
+		{"src/main/java/rx/internal/util/RxRingBuffer.java", "RxJava", BUNDLED_RX},
+		{"rx/observables/BlockingObservable.java", "RxJava", BUNDLED_RX},
+		{"libs/rxjava-1.3.8/rx/subjects/PublishSubject.java", "RxJava", BUNDLED_RX},
+		// packages of the project named like RxJava 1's
+		{"src/main/java/com/acme/rx/internal/Schedulers.java", "RxJava", NOT_EXCLUDED},
+		{"app/rx/plugins/Hooks.kt", "RxJava", NOT_EXCLUDED},
+		{"node_modules/rxjs/index.js", "RxJS", VENDORED},
+		{"packages/rxjs/src/internal/Observable.ts", "RxJS", BUNDLED_RX},
+		{"public/lib/rx.all.js", "RxJS", BUNDLED_RX},
+		{"js/Rx.umd.min.js", "RxJS", BUNDLED_RX},
+		// files of the project named like the builds of RxJS
+		{"src/rx.js", "RxJS", NOT_EXCLUDED},
+		{"src/utils/rxjs.js", "RxJS", NOT_EXCLUDED},
+		{"src/rx.js", "RxJava", NOT_EXCLUDED},
+		{"web/app.min.js", "RxJS", MINIFIED},
+		{"Sources/RxSwift/Observables/Map.swift", "RxSwift", BUNDLED_RX},
+		{"src/main/java/com/acme/ServiceGrpc.java", "RxJava", GENERATED},
+	}
+	for _, tt := range tests {
+		if got := classifyPath(tt.file, tt.dist, nil); got != tt.want {
+			t.Errorf("classifyPath(%q, %s) = %q, want %q", tt.file, tt.dist, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyContent(t *testing.T) {
+	umd := "(function (global, factory) {\n  typeof exports === 'object' ? factory(exports) :\n" +
+		"  typeof define === 'function' && define.amd ? define(['exports'], factory) : factory(global.Rx = {});\n}(this, function (exports) {}));\n"
+	minified := strings.Repeat("var a=function(b){return b};", 100)
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"bundle named like RxJS", "src/rx.js", umd, BUNDLED_RX},
+		{"minified build", "static/rx.lite.js", minified, BUNDLED_RX},
+		{"project file named like RxJS", "src/rx.js", "import { of } from 'rxjs';\nexport const ticks = of(1);\n", NOT_EXCLUDED},
+		{"other minified file", "src/app.js", minified, MINIFIED},
+		{"other bundle", "src/app.js", umd, NOT_EXCLUDED},
+		{"generated", "src/api.ts", "// Code generated by protoc-gen-ts. DO NOT EDIT.\nexport {};\n", GENERATED},
+	}
+	for _, tt := range tests {
+		if got := classifyContent(tt.file, tt.content, "RxJS", nil); got != tt.want {
+			t.Errorf("%s: classifyContent(%q) = %q, want %q", tt.name, tt.file, got, tt.want)
+		}
+	}
+}
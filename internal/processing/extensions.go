@@ -0,0 +1,29 @@
+package processing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/carloszimm/github-mining/internal/config"
+)
+
+type LangExtension struct {
+	Name         string   `json:"name"`
+	TypeLanguage string   `json:"-"`
+	Extensions   []string `json:"extensions"`
+}
+
+// loads the languages' extensions
+func readLanguageExtensions() ([]LangExtension, error) {
+	dat, err := os.ReadFile(config.EXTENSIONS_PATH)
+	if err != nil {
+		return nil, fmt.Errorf("reading the languages' extensions: %w", err)
+	}
+
+	var languageExtensions []LangExtension
+	if err := json.Unmarshal(dat, &languageExtensions); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", config.EXTENSIONS_PATH, err)
+	}
+	return languageExtensions, nil
+}
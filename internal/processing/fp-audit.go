@@ -0,0 +1,344 @@
+package processing
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// how the occurrences are stratified when drawing a false-positive audit sample
+const (
+	// up to size occurrences of each operator
+	STRATA_OPERATOR = "operator"
+	// size files, with all of their occurrences
+	STRATA_FILE = "file"
+)
+
+// labels of the audited occurrences
+const (
+	TRUE_POSITIVE  = "tp"
+	FALSE_POSITIVE = "fp"
+)
+
+var auditHeader = []string{"id", "stratum", "stratum_size", "distribution", "archive", "file",
+	"line", "column", "operator", "snippet", "label"}
+
+// occurrence drawn for the false-positive audit
+type AuditEntry struct {
+	types.Occurrence
+	Stratum string
+	// number of occurrences in the stratum, used to weight the precision estimate
+	StratumSize int
+	// TRUE_POSITIVE, FALSE_POSITIVE or empty while not labeled
+	Label string
+}
+
+// reads the occurrences (NDJSON) written by operator-search, keeping the ones accepted
+// by keep (all if nil); they are sorted by archive, file, line, column and operator,
+// so the same seed draws the same sample regardless of the order they were written
+func LoadOccurrences(path string, keep func(*types.Occurrence) bool) ([]types.Occurrence, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var occurrences []types.Occurrence
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var occurrence types.Occurrence
+		if err := decoder.Decode(&occurrence); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if keep == nil || keep(&occurrence) {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		a, b := occurrences[i], occurrences[j]
+		if a.Archive != b.Archive {
+			return a.Archive < b.Archive
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Operator < b.Operator
+	})
+	return occurrences, nil
+}
+
+// draws a seeded random sample of the (sorted) occurrences stratified by operator or by file
+func DrawAuditSample(occurrences []types.Occurrence, by string, size int, seed int64) ([]*AuditEntry, error) {
+	if by != STRATA_OPERATOR && by != STRATA_FILE {
+		return nil, fmt.Errorf("unknown strata %q (%s or %s)", by, STRATA_OPERATOR, STRATA_FILE)
+	}
+	strata := make(map[string][]int)
+	for i := range occurrences {
+		key := stratumKey(&occurrences[i], by)
+		strata[key] = append(strata[key], i)
+	}
+	keys := make([]string, 0, len(strata))
+	for key := range strata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rng := rand.New(rand.NewSource(seed))
+	var selected []int
+	if by == STRATA_FILE {
+		for _, k := range sample(rng, len(keys), size) {
+			selected = append(selected, strata[keys[k]]...)
+		}
+	} else {
+		for _, key := range keys {
+			for _, k := range sample(rng, len(strata[key]), size) {
+				selected = append(selected, strata[key][k])
+			}
+		}
+	}
+	sort.Ints(selected)
+
+	entries := make([]*AuditEntry, 0, len(selected))
+	for _, i := range selected {
+		key := stratumKey(&occurrences[i], by)
+		entries = append(entries, &AuditEntry{Occurrence: occurrences[i], Stratum: key,
+			StratumSize: len(strata[key])})
+	}
+	return entries, nil
+}
+
+func stratumKey(occurrence *types.Occurrence, by string) string {
+	if by == STRATA_FILE {
+		return occurrence.Archive + ":" + occurrence.File
+	}
+	return occurrence.Operator
+}
+
+// returns up to size indexes out of n, drawn without replacement
+func sample(rng *rand.Rand, n, size int) []int {
+	perm := rng.Perm(n)
+	if size < n {
+		perm = perm[:size]
+	}
+	return perm
+}
+
+// writes the entries as CSV to be labeled: the label column must be filled in with
+// tp (true positive) or fp (false positive)
+func WriteAuditSample(path string, entries []*AuditEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(auditHeader); err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if err := w.Write([]string{strconv.Itoa(i + 1), e.Stratum, strconv.Itoa(e.StratumSize),
+			e.Distribution, e.Archive, e.File, strconv.Itoa(e.Line), strconv.Itoa(e.Column),
+			e.Operator, e.Snippet, e.Label}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// reads a sample written by WriteAuditSample back, along with its labels
+func ReadAuditLabels(path string) ([]*AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(auditHeader, ",") {
+		return nil, fmt.Errorf("%s: not an audit sample (header must be %s)", path, strings.Join(auditHeader, ","))
+	}
+
+	entries := make([]*AuditEntry, 0, len(records)-1)
+	for i, record := range records[1:] {
+		line := i + 2
+		e := &AuditEntry{Stratum: record[1], Occurrence: types.Occurrence{Distribution: record[3],
+			Archive: record[4], File: record[5], Operator: record[8], Snippet: record[9]}}
+		if e.StratumSize, err = strconv.Atoi(record[2]); err != nil {
+			return nil, fmt.Errorf("%s:%d: stratum_size: %v", path, line, err)
+		}
+		if e.Line, err = strconv.Atoi(record[6]); err != nil {
+			return nil, fmt.Errorf("%s:%d: line: %v", path, line, err)
+		}
+		if e.Column, err = strconv.Atoi(record[7]); err != nil {
+			return nil, fmt.Errorf("%s:%d: column: %v", path, line, err)
+		}
+		if e.Label, err = parseLabel(record[10]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseLabel(label string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "":
+		return "", nil
+	case TRUE_POSITIVE, "true", "1", "yes", "y":
+		return TRUE_POSITIVE, nil
+	case FALSE_POSITIVE, "false", "0", "no", "n":
+		return FALSE_POSITIVE, nil
+	}
+	return "", fmt.Errorf("unknown label %q (%s or %s)", label, TRUE_POSITIVE, FALSE_POSITIVE)
+}
+
+// precision of the labeled occurrences with its Wilson score interval
+type Precision struct {
+	Operator       string  `json:"operator,omitempty"`
+	Labeled        int     `json:"labeled"`
+	TruePositives  int     `json:"truePositives"`
+	FalsePositives int     `json:"falsePositives"`
+	Precision      float64 `json:"precision"`
+	Lower          float64 `json:"lower"`
+	Upper          float64 `json:"upper"`
+}
+
+type PrecisionReport struct {
+	Confidence float64 `json:"confidence"`
+	Unlabeled  int     `json:"unlabeled"`
+	// pooled over all labeled occurrences
+	Overall *Precision `json:"overall"`
+	// precision of each sampled stratum weighted by its size; with strata by operator,
+	// it estimates the precision of all occurrences and not only of the sampled ones
+	Weighted  float64      `json:"weighted"`
+	Operators []*Precision `json:"operators"`
+}
+
+// estimates the precision per operator and overall at the given confidence level (e.g. 0.95)
+func EstimatePrecision(entries []*AuditEntry, confidence float64) *PrecisionReport {
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	report := &PrecisionReport{Confidence: confidence, Overall: &Precision{}}
+	operators := make(map[string]*Precision)
+	type stratum struct{ size, tp, labeled int }
+	strata := make(map[string]*stratum)
+	for _, e := range entries {
+		if e.Label == "" {
+			report.Unlabeled++
+			continue
+		}
+		p, ok := operators[e.Operator]
+		if !ok {
+			p = &Precision{Operator: e.Operator}
+			operators[e.Operator] = p
+		}
+		s, ok := strata[e.Stratum]
+		if !ok {
+			s = &stratum{size: e.StratumSize}
+			strata[e.Stratum] = s
+		}
+		s.labeled++
+		for _, p := range []*Precision{p, report.Overall} {
+			p.Labeled++
+			if e.Label == TRUE_POSITIVE {
+				p.TruePositives++
+			} else {
+				p.FalsePositives++
+			}
+		}
+		if e.Label == TRUE_POSITIVE {
+			s.tp++
+		}
+	}
+
+	for _, p := range operators {
+		p.estimate(z)
+		report.Operators = append(report.Operators, p)
+	}
+	sort.Slice(report.Operators, func(i, j int) bool {
+		return report.Operators[i].Operator < report.Operators[j].Operator
+	})
+	report.Overall.estimate(z)
+
+	total := 0
+	for _, s := range strata {
+		report.Weighted += float64(s.size) * float64(s.tp) / float64(s.labeled)
+		total += s.size
+	}
+	if total > 0 {
+		report.Weighted /= float64(total)
+	}
+	return report
+}
+
+func (p *Precision) estimate(z float64) {
+	if p.Labeled == 0 {
+		return
+	}
+	p.Precision = float64(p.TruePositives) / float64(p.Labeled)
+	p.Lower, p.Upper = wilson(p.TruePositives, p.Labeled, z)
+}
+
+// Wilson score interval of a proportion of successes out of n
+func wilson(successes, n int, z float64) (float64, float64) {
+	phat := float64(successes) / float64(n)
+	z2n := z * z / float64(n)
+	center := (phat + z2n/2) / (1 + z2n)
+	margin := z / (1 + z2n) * math.Sqrt(phat*(1-phat)/float64(n)+z2n/(4*float64(n)))
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// writes the report to <path>.json and a row per operator (plus the overall one) to <path>.csv
+func (r *PrecisionReport) Write(path string) error {
+	if err := util.WritePrettyJSON(path, r); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path + ".csv")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"operator", "labeled", "tp", "fp", "precision", "lower", "upper"}); err != nil {
+		return err
+	}
+	overall := *r.Overall
+	overall.Operator = "(overall)"
+	for _, p := range append(r.Operators, &overall) {
+		if err := w.Write([]string{p.Operator, strconv.Itoa(p.Labeled), strconv.Itoa(p.TruePositives),
+			strconv.Itoa(p.FalsePositives), formatFloat(p.Precision), formatFloat(p.Lower),
+			formatFloat(p.Upper)}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
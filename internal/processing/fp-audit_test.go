@@ -0,0 +1,65 @@
+package processing
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/carloszimm/github-mining/internal/types"
+)
+
+func TestWilson(t *testing.T) {
+	tests := []struct {
+		successes, n int
+		z            float64
+		lo, hi       float64
+	}{
+		{0, 10, 1.96, 0, 0.2775},
+		{10, 10, 1.96, 0.7225, 1},
+		{5, 10, 1.96, 0.2366, 0.7634},
+		{81, 100, 1.96, 0.7222, 0.8749},
+	}
+	for _, tt := range tests {
+		lo, hi := wilson(tt.successes, tt.n, tt.z)
+		if math.Abs(lo-tt.lo) > 1e-4 || math.Abs(hi-tt.hi) > 1e-4 {
+			t.Errorf("wilson(%d, %d) = [%.4f, %.4f], want [%.4f, %.4f]", tt.successes, tt.n, lo, hi, tt.lo, tt.hi)
+		}
+	}
+}
+
+func TestPrecisionReportWrite(t *testing.T) {
+	entry := func(op, stratum, label string) *AuditEntry {
+		return &AuditEntry{Occurrence: types.Occurrence{Operator: op}, Stratum: stratum, StratumSize: 10, Label: label}
+	}
+	report := EstimatePrecision([]*AuditEntry{
+		entry("map", "map", TRUE_POSITIVE), entry("map", "map", FALSE_POSITIVE),
+		entry("filter", "filter", TRUE_POSITIVE), entry("filter", "filter", ""),
+	}, 0.95)
+	if report.Unlabeled != 1 || report.Overall.Labeled != 3 || report.Overall.TruePositives != 2 {
+		t.Fatalf("report = %+v, overall %+v", report, report.Overall)
+	}
+
+	path := filepath.Join(t.TempDir(), "sample_precision")
+	if err := report.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	var written PrecisionReport
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &written); err != nil || !reflect.DeepEqual(&written, report) {
+		t.Errorf("written report = %+v (%v), want %+v", written, err, report)
+	}
+	rows, err := os.ReadFile(path + ".csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(rows), "\n"); lines != 4 {
+		t.Errorf("%d CSV lines, want the header, 2 operators and the overall one:\n%s", lines, rows)
+	}
+}
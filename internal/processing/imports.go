@@ -0,0 +1,234 @@
+package processing
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/types"
+)
+
+// module (package) prefixes that identify a Rx distribution in the import statements
+// of its language (syntax)
+type DistributionModule struct {
+	Syntax   string
+	Prefixes []string
+}
+
+// modules of each distribution; keys are the lower-case distribution names as used in config.json
+var DistributionModules = map[string]DistributionModule{
+	// rx. -> RxJava 1, io.reactivex. -> RxJava 2 and 3
+	"rxjava":    {jvmSyntax, []string{"io.reactivex", "rx"}},
+	"rxjs":      {jsSyntax, []string{"rxjs", "@reactivex/rxjs"}},
+	"rxswift":   {swiftSyntax, []string{"RxSwift", "RxCocoa", "RxRelay", "RxBlocking", "RxTest"}},
+	"rxkotlin":  {jvmSyntax, []string{"io.reactivex.rxkotlin", "io.reactivex.rxjava3.kotlin"}},
+	"rxandroid": {jvmSyntax, []string{"io.reactivex.android", "io.reactivex.rxjava3.android", "rx.android"}},
+	// epics are built with RxJS operators, so files importing it usually import rxjs as well
+	"redux-observable": {jsSyntax, []string{"redux-observable"}},
+}
+
+// import syntaxes supported by the parser
+const (
+	jvmSyntax   = "jvm"
+	jsSyntax    = "js"
+	swiftSyntax = "swift"
+)
+
+var (
+	// Java and Kotlin: import [static] a.b.C[.*] [as D][;]
+	jvmImportReg = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+(static[ \t]+)?([\w.]+?)(\.\*)?(?:[ \t]+as[ \t]+(\w+))?[ \t]*;?[ \t]*$`)
+	// ES modules: import <clause> from 'module' and export <clause> from 'module'
+	jsImportFromReg = regexp.MustCompile(`\b(?:import|export)\s+(?:type\s+)?([\w$*{},\s]+?)\s*from\s*['"]([^'"\n]+)['"]`)
+	// side-effect and dynamic imports: import 'module' / import('module')
+	jsImportBareReg = regexp.MustCompile(`\bimport\s*\(?\s*['"]([^'"\n]+)['"]`)
+	// CommonJS: [const <binding> =] require('module')
+	jsRequireReg = regexp.MustCompile(`(?:\b(?:const|let|var)\s+(\{[^}]*\}|[\w$]+)\s*=\s*)?\brequire\s*\(\s*['"]([^'"\n]+)['"]\s*\)`)
+	// Swift: [@attribute] import [kind] Module[.Symbol]
+	swiftImportReg = regexp.MustCompile(`(?m)^[ \t]*(?:@\w+(?:\([^)\n]*\))?[ \t]+)*import[ \t]+(?:(?:typealias|struct|class|enum|protocol|let|var|func)[ \t]+)?([\w.]+)`)
+)
+
+// returns the import syntax used by a file according to its extension
+// an empty string means that the syntax is unknown and all parsers should be tried
+func importSyntax(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".java", ".kt", ".kts", ".ktm", ".groovy", ".scala":
+		return jvmSyntax
+	case ".js", ".jsx", ".mjs", ".cjs", ".es", ".es6", ".ts", ".tsx", ".mts", ".cts":
+		return jsSyntax
+	case ".swift":
+		return swiftSyntax
+	}
+	return ""
+}
+
+// parses the import statements of a file
+func ParseImports(fileName, content string) []types.Import {
+	switch importSyntax(fileName) {
+	case jvmSyntax:
+		return parseJVMImports(content)
+	case jsSyntax:
+		return parseJSImports(content)
+	case swiftSyntax:
+		return parseSwiftImports(content)
+	}
+	imports := parseJVMImports(content)
+	imports = append(imports, parseJSImports(content)...)
+	return append(imports, parseSwiftImports(content)...)
+}
+
+func parseJVMImports(content string) []types.Import {
+	var imports []types.Import
+	for _, m := range jvmImportReg.FindAllStringSubmatch(content, -1) {
+		static, name, wildcard, alias := m[1] != "", m[2], m[3] != "", m[4]
+		imp := types.Import{Module: name, Syntax: jvmSyntax}
+		switch {
+		case wildcard:
+		case static:
+			// import static a.b.C.member -> module a.b.C, symbol member
+			i := strings.LastIndex(name, ".")
+			if i < 0 {
+				continue
+			}
+			imp.Module, imp.Symbols = name[:i], []string{name[i+1:]}
+		default:
+			imp.Symbols = []string{lastSegment(name, ".")}
+		}
+		// Kotlin: import a.b.C as D
+		if alias != "" && len(imp.Symbols) > 0 {
+			imp.Aliases = map[string]string{alias: imp.Symbols[0]}
+		}
+		imports = append(imports, imp)
+	}
+	return imports
+}
+
+func parseJSImports(content string) []types.Import {
+	var imports []types.Import
+	for _, m := range jsImportFromReg.FindAllStringSubmatch(content, -1) {
+		symbols, aliases := parseJSBindings(m[1])
+		imports = append(imports, types.Import{Module: m[2], Symbols: symbols, Aliases: aliases, Syntax: jsSyntax})
+	}
+	for _, m := range jsImportBareReg.FindAllStringSubmatch(content, -1) {
+		imports = append(imports, types.Import{Module: m[1], Syntax: jsSyntax})
+	}
+	for _, m := range jsRequireReg.FindAllStringSubmatch(content, -1) {
+		symbols, aliases := parseJSBindings(m[1])
+		imports = append(imports, types.Import{Module: m[2], Symbols: symbols, Aliases: aliases, Syntax: jsSyntax})
+	}
+	return imports
+}
+
+// returns the imported names of an import clause or a destructuring require binding
+// along with the local names of the ones renamed
+// e.g. `{ map, filter as f }` -> [map filter], {f: filter}; namespace and default bindings
+// are kept under their local name since they are used as receivers (e.g. Rx.Observable)
+func parseJSBindings(clause string) (symbols []string, aliases map[string]string) {
+	clause = strings.TrimSpace(clause)
+	if clause == "" {
+		return
+	}
+	named := ""
+	if i := strings.Index(clause, "{"); i >= 0 {
+		j := strings.LastIndex(clause, "}")
+		if j < i {
+			j = len(clause)
+		}
+		named = clause[i+1 : j]
+		clause = clause[:i] + clause[j:]
+	}
+	// default and namespace imports: `Rx`, `* as Rx`
+	for _, part := range strings.Split(clause, ",") {
+		part = strings.TrimSpace(strings.Trim(strings.TrimSpace(part), "}"))
+		if part == "" {
+			continue
+		}
+		fields := strings.Fields(part)
+		symbols = append(symbols, fields[len(fields)-1])
+	}
+	// named imports: `a`, `a as b` (import) and `a: b` (destructuring)
+	for _, part := range strings.Split(named, ",") {
+		fields := strings.Fields(strings.Replace(part, ":", " as ", 1))
+		if len(fields) > 0 && fields[0] == "type" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		symbols = append(symbols, fields[0])
+		if len(fields) == 3 && fields[1] == "as" && fields[2] != fields[0] {
+			if aliases == nil {
+				aliases = make(map[string]string)
+			}
+			aliases[fields[2]] = fields[0]
+		}
+	}
+	return
+}
+
+func parseSwiftImports(content string) []types.Import {
+	var imports []types.Import
+	for _, m := range swiftImportReg.FindAllStringSubmatch(content, -1) {
+		// import struct RxSwift.Observable -> module RxSwift, symbol Observable
+		parts := strings.SplitN(m[1], ".", 2)
+		imp := types.Import{Module: parts[0], Syntax: swiftSyntax}
+		if len(parts) > 1 {
+			imp.Symbols = []string{parts[1]}
+		}
+		imports = append(imports, imp)
+	}
+	return imports
+}
+
+func lastSegment(name, sep string) string {
+	return name[strings.LastIndex(name, sep)+1:]
+}
+
+// returns a function that tells whether an import belongs to the distribution: its module
+// must be in the distribution's language and belong to the distribution with the longest
+// (most specific) prefix matching it, e.g. io.reactivex.rxkotlin is RxKotlin's, not RxJava's
+// distributions not listed in DistributionModules are matched by their name in any language
+func DistributionModuleMatcher(dist string) func(types.Import) bool {
+	modules, ok := DistributionModules[strings.ToLower(dist)]
+	if !ok {
+		modules = DistributionModule{Prefixes: []string{dist}}
+	}
+	return func(imp types.Import) bool {
+		if modules.Syntax != "" && imp.Syntax != modules.Syntax {
+			return false
+		}
+		length := longestModulePrefix(imp.Module, modules.Prefixes)
+		if length == 0 {
+			return false
+		}
+		for other, otherModules := range DistributionModules {
+			if other != strings.ToLower(dist) && otherModules.Syntax == imp.Syntax &&
+				longestModulePrefix(imp.Module, otherModules.Prefixes) > length {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// returns the length of the longest prefix matching the module, or 0 if none matches
+func longestModulePrefix(module string, prefixes []string) int {
+	longest := 0
+	for _, prefix := range prefixes {
+		if (module == prefix || strings.HasPrefix(module, prefix+".") ||
+			strings.HasPrefix(module, prefix+"/")) && len(prefix) > longest {
+			longest = len(prefix)
+		}
+	}
+	return longest
+}
+
+// returns the imports that belong to the distribution
+func distributionImports(imports []types.Import, isDistModule func(types.Import) bool) []types.Import {
+	var distImports []types.Import
+	for _, imp := range imports {
+		if isDistModule(imp) {
+			distImports = append(distImports, imp)
+		}
+	}
+	return distImports
+}
@@ -0,0 +1,83 @@
+package processing
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/carloszimm/github-mining/internal/types"
+)
+
+func TestParseImports(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		want                []types.Import
+	}{
+		{"java", "A.java", "package a;\nimport io.reactivex.Observable;\nimport static io.reactivex.Flowable.just;\nimport rx.*;\n",
+			[]types.Import{
+				{Module: "io.reactivex.Observable", Symbols: []string{"Observable"}, Syntax: jvmSyntax},
+				{Module: "io.reactivex.Flowable", Symbols: []string{"just"}, Syntax: jvmSyntax},
+				{Module: "rx", Syntax: jvmSyntax},
+			}},
+		{"kotlin alias", "a.kt", "import io.reactivex.rxkotlin.subscribeBy as sub\n",
+			[]types.Import{{Module: "io.reactivex.rxkotlin.subscribeBy", Symbols: []string{"subscribeBy"},
+				Aliases: map[string]string{"sub": "subscribeBy"}, Syntax: jvmSyntax}}},
+		{"es modules", "a.ts", "import { map, filter as f } from 'rxjs/operators';\nimport * as Rx from \"rxjs\";\nexport { of } from 'rxjs';\n",
+			[]types.Import{
+				{Module: "rxjs/operators", Symbols: []string{"map", "filter"}, Aliases: map[string]string{"f": "filter"}, Syntax: jsSyntax},
+				{Module: "rxjs", Symbols: []string{"Rx"}, Syntax: jsSyntax},
+				{Module: "rxjs", Symbols: []string{"of"}, Syntax: jsSyntax},
+			}},
+		{"default and named", "a.js", "import Rx, { type Observable } from 'rxjs';\n",
+			[]types.Import{{Module: "rxjs", Symbols: []string{"Rx", "Observable"}, Syntax: jsSyntax}}},
+		{"side effect and dynamic", "a.js", "import 'rxjs/add/operator/map';\nconst m = await import('rxjs');\n",
+			[]types.Import{{Module: "rxjs/add/operator/map", Syntax: jsSyntax}, {Module: "rxjs", Syntax: jsSyntax}}},
+		{"commonjs", "a.js", "const Rx = require('rxjs');\nconst { map: rxMap, take } = require(\"rxjs/operators\");\nrequire('rx');\n",
+			[]types.Import{
+				{Module: "rxjs", Symbols: []string{"Rx"}, Syntax: jsSyntax},
+				{Module: "rxjs/operators", Symbols: []string{"map", "take"}, Aliases: map[string]string{"rxMap": "map"}, Syntax: jsSyntax},
+				{Module: "rx", Syntax: jsSyntax},
+			}},
+		{"swift", "a.swift", "import RxSwift\n@testable import RxCocoa\nimport struct RxRelay.BehaviorRelay\n",
+			[]types.Import{
+				{Module: "RxSwift", Syntax: swiftSyntax},
+				{Module: "RxCocoa", Syntax: swiftSyntax},
+				{Module: "RxRelay", Symbols: []string{"BehaviorRelay"}, Syntax: swiftSyntax},
+			}},
+		{"not imports", "a.ts", "const myRxJsHelper = 1; // import nothing\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseImports(tt.file, tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseImports = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributionModuleMatcher(t *testing.T) {
+	tests := []struct {
+		dist   string
+		imp    types.Import
+		belong bool
+	}{
+		{"RxJava", types.Import{Module: "io.reactivex.rxjava3.core", Syntax: jvmSyntax}, true},
+		{"RxJava", types.Import{Module: "rx.Observable", Syntax: jvmSyntax}, true},
+		{"RxJava", types.Import{Module: "rxjava.Helper", Syntax: jvmSyntax}, false},
+		// RxKotlin's module is more specific than RxJava's
+		{"RxJava", types.Import{Module: "io.reactivex.rxkotlin.Observables", Syntax: jvmSyntax}, false},
+		{"RxKotlin", types.Import{Module: "io.reactivex.rxkotlin.Observables", Syntax: jvmSyntax}, true},
+		// the prefixes only apply to the language of the distribution
+		{"RxJava", types.Import{Module: "rx", Syntax: jsSyntax}, false},
+		{"RxJS", types.Import{Module: "rxjs/operators", Syntax: jsSyntax}, true},
+		{"RxJS", types.Import{Module: "rxjs-compat", Syntax: jsSyntax}, false},
+		{"RxJS", types.Import{Module: "rxjs", Syntax: jvmSyntax}, false},
+		{"RxSwift", types.Import{Module: "RxCocoa", Syntax: swiftSyntax}, true},
+		// distributions without modules are matched by their name
+		{"RxPY", types.Import{Module: "RxPY.operators", Syntax: jsSyntax}, true},
+	}
+	for _, tt := range tests {
+		if got := DistributionModuleMatcher(tt.dist)(tt.imp); got != tt.belong {
+			t.Errorf("DistributionModuleMatcher(%s)(%+v) = %v, want %v", tt.dist, tt.imp, got, tt.belong)
+		}
+	}
+}
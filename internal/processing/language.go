@@ -0,0 +1,254 @@
+package processing
+
+import (
+	"bufio"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// extensions missing from Programming_Languages_Extensions.json
+var ExtraExtensions = map[string][]string{
+	"JavaScript": {".mjs", ".cjs"},
+	"TypeScript": {".mts", ".cts"},
+}
+
+// interpreters of shebangs (#!/usr/bin/env node, #!/usr/bin/node) -> language
+var Interpreters = map[string]string{
+	"node":    "JavaScript",
+	"nodejs":  "JavaScript",
+	"ts-node": "TypeScript",
+	"deno":    "TypeScript",
+	"kotlin":  "Kotlin",
+	"kscript": "Kotlin",
+	"swift":   "Swift",
+	"java":    "Java",
+}
+
+// names of modelines' modes (lowercase) other than the languages' own names
+var ModeAliases = map[string]string{
+	"js":         "JavaScript",
+	"javascript": "JavaScript",
+	"ts":         "TypeScript",
+	"typescript": "TypeScript",
+	"kt":         "Kotlin",
+	"objc":       "Objective-C",
+	"cpp":        "C++",
+	"c++":        "C++",
+}
+
+// content heuristics telling apart the languages sharing an extension (e.g. .h),
+// tried in the order given; the last candidate is the fallback
+var Heuristics = []struct {
+	Language string
+	Regex    *regexp.Regexp
+}{
+	{"Objective-C", regexp.MustCompile(`(?m)^\s*(@interface|@implementation|@protocol|@end\b|#import\b)`)},
+	{"C++", regexp.MustCompile(`(?m)^\s*(class\s+\w+|namespace\s+\w*|template\s*<)|\bstd::|#include\s*<(iostream|string|vector|memory|map)>`)},
+}
+
+var (
+	// vim: set ft=typescript: / vi: filetype=js / ex: syntax=kotlin
+	vimModelineReg = regexp.MustCompile(`(?:vim?|ex):.*?\b(?:ft|filetype|syntax)=([\w+-]+)`)
+	// -*- mode: js -*- / -*- js -*-
+	emacsModelineReg = regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*)?([\w+-]+?)(?:-mode)?\s*(?:;.*?)?-\*-`)
+	shebangReg       = regexp.MustCompile(`^#!\s*(\S+)(?:\s+(?:-\S+\s+)*(\S+))?`)
+)
+
+// number of lines at the beginning and at the end of a file searched for modelines,
+// within its first and last MODELINE_BYTES bytes
+const (
+	MODELINE_LINES = 5
+	MODELINE_BYTES = 4096
+)
+
+// beginning of the scripts identified by their interpreter
+const SHEBANG = "#!"
+
+// number of bytes inspected to tell binary files apart
+const BINARY_SNIFF_LENGTH = 8000
+
+// size of MPEG transport stream packets, all starting with a sync byte
+const MPEG_TS_PACKET = 188
+
+// consecutive packets required to take a file for an MPEG transport stream
+const MPEG_TS_MIN_PACKETS = 4
+
+// classifies the files into the languages searched by extension, shebang, modeline
+// and content heuristics, rejecting binary files
+type LanguageClassifier struct {
+	// searched languages (names as in Programming_Languages_Extensions.json)
+	languages map[string]bool
+	// extension -> searched languages using it
+	extensions map[string][]string
+}
+
+// returns the classifier of the given languages (entries of Programming_Languages_Extensions.json)
+func LoadLanguages(languages []string) (*LanguageClassifier, error) {
+	languageExtensions, err := readLanguageExtensions()
+	if err != nil {
+		return nil, err
+	}
+	lc := &LanguageClassifier{languages: make(map[string]bool), extensions: make(map[string][]string)}
+	for _, lang := range languages {
+		lc.languages[lang] = true
+	}
+	add := func(ext, lang string) {
+		for _, l := range lc.extensions[ext] {
+			if l == lang {
+				return
+			}
+		}
+		lc.extensions[ext] = append(lc.extensions[ext], lang)
+	}
+	for _, langExt := range languageExtensions {
+		if lc.languages[langExt.Name] {
+			for _, ext := range langExt.Extensions {
+				add(ext, langExt.Name)
+			}
+		}
+	}
+	for lang, exts := range ExtraExtensions {
+		if lc.languages[lang] {
+			for _, ext := range exts {
+				add(ext, lang)
+			}
+		}
+	}
+	for _, langs := range lc.extensions {
+		sort.Strings(langs)
+	}
+	return lc, nil
+}
+
+// indicates if the file has to be read to be classified: it has the extension of a
+// searched language or no extension and a shebang (scripts), which is peeked from content
+func (lc *LanguageClassifier) Candidate(filePath string, content *bufio.Reader) bool {
+	ext := path.Ext(filePath)
+	if ext == "" {
+		if strings.HasPrefix(path.Base(filePath), ".") {
+			return false
+		}
+		head, _ := content.Peek(len(SHEBANG))
+		return string(head) == SHEBANG
+	}
+	_, ok := lc.extensions[ext]
+	return ok
+}
+
+// returns the searched language of the file, if any; a searched language given by a
+// modeline takes precedence over the one of a shebang, which takes precedence over the extension
+func (lc *LanguageClassifier) Classify(filePath, content string) (string, bool) {
+	if IsBinary(content) {
+		return "", false
+	}
+	if lang, ok := lc.modelineLanguage(content); ok {
+		return lang, true
+	}
+	if lang, ok := shebangLanguage(content); ok && lc.languages[lang] {
+		return lang, true
+	}
+	candidates := lc.extensions[path.Ext(filePath)]
+	switch len(candidates) {
+	case 0:
+		return "", false
+	case 1:
+		return candidates[0], true
+	}
+	for _, h := range Heuristics {
+		for _, lang := range candidates {
+			if lang == h.Language && h.Regex.MatchString(content) {
+				return lang, true
+			}
+		}
+	}
+	return candidates[len(candidates)-1], true
+}
+
+// indicates if the content is binary: it has NUL bytes or the packets of an
+// MPEG transport stream (which share the .ts extension with TypeScript); text
+// decoding as UTF-8 isn't taken for a stream, whatever its bytes at the packet offsets
+func IsBinary(content string) bool {
+	sniff := content
+	if len(sniff) > BINARY_SNIFF_LENGTH {
+		sniff = sniff[:BINARY_SNIFF_LENGTH]
+	}
+	if strings.IndexByte(sniff, 0) >= 0 {
+		return true
+	}
+	if len(content) < MPEG_TS_MIN_PACKETS*MPEG_TS_PACKET || utf8.ValidString(sniff) {
+		return false
+	}
+	for i := 0; i < MPEG_TS_MIN_PACKETS; i++ {
+		if content[i*MPEG_TS_PACKET] != 0x47 {
+			return false
+		}
+	}
+	return true
+}
+
+func (lc *LanguageClassifier) modelineLanguage(content string) (string, bool) {
+	for _, line := range modelineLines(content) {
+		for _, re := range []*regexp.Regexp{vimModelineReg, emacsModelineReg} {
+			if m := re.FindStringSubmatch(line); m != nil {
+				if lang, ok := lc.modeLanguage(m[1]); ok {
+					return lang, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// returns the first and the last MODELINE_LINES lines of the content, only splitting
+// its first and last MODELINE_BYTES bytes (lines of short files may be repeated)
+func modelineLines(content string) []string {
+	head, tail := content, content
+	if len(content) > MODELINE_BYTES {
+		head, tail = content[:MODELINE_BYTES], content[len(content)-MODELINE_BYTES:]
+	}
+	lines := strings.SplitN(head, "\n", MODELINE_LINES+1)
+	if len(lines) > MODELINE_LINES {
+		lines = lines[:MODELINE_LINES]
+	}
+	tailLines := strings.Split(tail, "\n")
+	if len(tailLines) > MODELINE_LINES {
+		tailLines = tailLines[len(tailLines)-MODELINE_LINES:]
+	}
+	return append(lines, tailLines...)
+}
+
+// maps the mode of a modeline to a searched language
+func (lc *LanguageClassifier) modeLanguage(mode string) (string, bool) {
+	mode = strings.ToLower(mode)
+	if lang, ok := ModeAliases[mode]; ok {
+		return lang, lc.languages[lang]
+	}
+	for lang := range lc.languages {
+		if strings.ToLower(lang) == mode {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+func shebangLanguage(content string) (string, bool) {
+	line := content
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		line = content[:i]
+	}
+	m := shebangReg.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return "", false
+	}
+	interpreter := path.Base(m[1])
+	if interpreter == "env" {
+		interpreter = path.Base(m[2])
+	}
+	// node14, swift5.5...
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+	lang, ok := Interpreters[interpreter]
+	return lang, ok
+}
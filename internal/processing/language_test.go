@@ -0,0 +1,72 @@
+package processing
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func testClassifier() *LanguageClassifier {
+	return &LanguageClassifier{
+		languages: map[string]bool{"JavaScript": true, "TypeScript": true, "Objective-C": true, "C++": true},
+		extensions: map[string][]string{".js": {"JavaScript"}, ".ts": {"TypeScript"},
+			".h": {"C++", "Objective-C"}},
+	}
+}
+
+func TestCandidate(t *testing.T) {
+	tests := []struct {
+		file, content string
+		candidate     bool
+	}{
+		{"src/app.ts", "", true},
+		{"src/app.java", "", false},
+		{"bin/cli", "#!/usr/bin/env node\nrequire('./cli')\n", true},
+		// extensionless files are only read when they are scripts
+		{"LICENSE", "MIT License\n", false},
+		{"bin/run", "", false},
+		{"Makefile", "# #!/bin/sh\n", false},
+		{".eslintrc", "#!", false},
+	}
+	lc := testClassifier()
+	for _, tt := range tests {
+		if got := lc.Candidate(tt.file, bufio.NewReader(strings.NewReader(tt.content))); got != tt.candidate {
+			t.Errorf("Candidate(%q) = %v, want %v", tt.file, got, tt.candidate)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"extension", "a.ts", "let a = 1\n", "TypeScript"},
+		{"not searched", "a.kt", "val a = 1\n", ""},
+		{"shebang", "bin/cli", "#!/usr/bin/env node14\n", "JavaScript"},
+		{"shebang of another language", "bin/cli", "#!/bin/sh\n", ""},
+		{"shebang over extension", "cli.js", "#!/usr/bin/env ts-node\n", "TypeScript"},
+		{"vim modeline", "a.js", "// vim: set ft=typescript:\nlet a = 1\n", "TypeScript"},
+		{"emacs modeline", "cli", "#!/bin/sh\n// -*- mode: js -*-\n", "JavaScript"},
+		{"modeline at the end", "a.ts", strings.Repeat("f()\n", 20) + "// vim: ft=js\n", "JavaScript"},
+		{"modeline in the middle", "a.ts", strings.Repeat("f()\n", 10) + "// vim: ft=js\n" + strings.Repeat("f()\n", 10), "TypeScript"},
+		// only the first and last MODELINE_BYTES are searched for lines
+		{"modeline after a long head", "a.ts", strings.Repeat("x", MODELINE_BYTES) + "\n// vim: ft=js\n" + strings.Repeat("f()\n", 2000), "TypeScript"},
+		{"modeline after a long line", "a.ts", strings.Repeat("x", 2*MODELINE_BYTES) + "\n// vim: ft=js", "JavaScript"},
+		{"heuristics", "a.h", "#import <Foundation/Foundation.h>\n@interface A\n@end\n", "Objective-C"},
+		{"heuristics fallback", "a.h", "int f(void);\n", "Objective-C"},
+		{"binary", "a.ts", strings.Repeat("\x47"+strings.Repeat("\xff", MPEG_TS_PACKET-1), MPEG_TS_MIN_PACKETS), ""},
+		// 'G' (the sync byte) at the packet offsets
+		{"short text at the packet offsets", "a.ts", strings.Repeat("G"+strings.Repeat("x", MPEG_TS_PACKET-1), 2), "TypeScript"},
+		{"text at the packet offsets", "a.ts", strings.Repeat("G"+strings.Repeat("x", MPEG_TS_PACKET-1), MPEG_TS_MIN_PACKETS), "TypeScript"},
+		{"too few packets", "a.ts", strings.Repeat("\x47"+strings.Repeat("\xff", MPEG_TS_PACKET-1), 3), "TypeScript"},
+	}
+	lc := testClassifier()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lc.Classify(tt.file, tt.content)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("Classify(%q) = %q, %v, want %q", tt.file, got, ok, tt.want)
+			}
+		})
+	}
+}
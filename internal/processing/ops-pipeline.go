@@ -1,27 +1,39 @@
 package processing
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
-	"regexp"
+	"path"
 	"sort"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/carloszimm/github-mining/internal/config"
+	"github.com/carloszimm/github-mining/internal/pipeline"
+	"github.com/carloszimm/github-mining/internal/progress"
 	"github.com/carloszimm/github-mining/internal/types"
-	"github.com/carloszimm/github-mining/internal/util"
 	"github.com/dlclark/regexp2"
 	"github.com/iancoleman/orderedmap"
 )
 
-var CheckFalsePositives bool
+// options of a run of the operators pipeline
+type Options struct {
+	// path of the NDJSON file where occurrences are written; empty disables them
+	OccurrencesPath string
+	// indicates if vendored, generated, minified and bundled Rx files are kept
+	KeepExcludedFiles bool
+	// indicates if chains of operators are extracted and their n-grams counted
+	ExtractChains bool
+	// receives the files processed, archives finished and the stages' metrics (optional)
+	Progress *progress.Tracker
+}
 
 // comment pattern acquired from:
 // https://stackoverflow.com/questions/36725194/golang-regex-replace-excluding-quoted-strings
@@ -33,226 +45,651 @@ const (
 
 var stringsReg = regexp2.MustCompile(stringsPattern, 0)
 
-func SetupOpsPipeline(allowedExtensions map[string]struct{}, operators *types.Operators,
-	result *orderedmap.OrderedMap) <-chan int {
-	// create workers from the list of operators
-	inOps, outOps := operators.CreateWorkerOps()
+// results of a distribution gathered by the operators pipeline
+type Results struct {
+	// archive -> operator -> total
+	Counts *orderedmap.OrderedMap
+	// archive -> file class (test, production, sample) -> operator -> total
+	CountsByClass *orderedmap.OrderedMap
+	// archive -> language of the files -> operator -> total
+	CountsByLanguage *orderedmap.OrderedMap
+	// n-grams of the operators chains (only when they are extracted)
+	NGrams *NGrams
+	// operators co-occurrence at file and repository level (only when they are built)
+	CoOccurrences *CoOccurrences
+	// archive -> n-grams of its files, until the archive is finished
+	pendingNGrams map[string]*NGrams
+}
 
-	out := processArchives(operators.Dist)
+func NewResults(counts *orderedmap.OrderedMap) *Results {
+	return &Results{Counts: counts, CountsByClass: orderedmap.New(), CountsByLanguage: orderedmap.New(),
+		pendingNGrams: make(map[string]*NGrams)}
+}
 
-	var i int
-	outChannels := make([]<-chan interface{}, config.PROCESSING_WORKERS)
-	for i = 0; i < config.PROCESSING_WORKERS; i++ {
-		outChannels[i] = processArchive(out, allowedExtensions, operators.Dist)
+// returns the n-grams of an archive not committed yet
+func (results *Results) archiveNGrams(archive string) *NGrams {
+	ngrams, ok := results.pendingNGrams[archive]
+	if !ok {
+		ngrams = NewNGrams()
+		results.pendingNGrams[archive] = ngrams
 	}
-	out = util.MergeChannels(outChannels...)
+	return ngrams
+}
 
-	// pass a different regex for each goroutine to avoid possible contention
-	// given the complexity of the regular expression
-	for i = 0; i < config.PROCESSING_WORKERS; i++ {
-		outChannels[i] = removeComments(out, regexp2.MustCompile(commentsPattern, 0))
+// adds the n-grams and co-occurrences of a finished archive to the results
+func (results *Results) commit(archive string) {
+	if results.NGrams != nil {
+		results.NGrams.Merge(results.archiveNGrams(archive))
+		delete(results.pendingNGrams, archive)
+	}
+	if results.CoOccurrences != nil {
+		results.CoOccurrences.Commit(archive)
 	}
-	out = util.MergeChannels(outChannels...)
+}
 
-	// check imports before removing strings to avoid not matching
-	// string paths of the imports (JS)
-	regDistPattern := "(?i)" + operators.Dist
-	if strings.EqualFold(operators.Dist, "RxJava") {
-		regDistPattern += "|reactivex"
+// drops the n-grams and co-occurrences of an archive that won't be finished
+func (results *Results) drop(archive string) {
+	delete(results.pendingNGrams, archive)
+	if results.CoOccurrences != nil {
+		results.CoOccurrences.Remove(archive)
+	}
+}
+
+// results of all distributions searched in the same pass over the archives
+type RunResults struct {
+	// distributions in the order they were added
+	Order []string
+	// distribution -> results
+	Distributions map[string]*Results
+	// archives whose reading failed -> error
+	Quarantined map[string]string
+	// store where each archive is written once finished (optional)
+	Checkpoint *Checkpoint
+	// archives left unfinished by a cancellation, whose counts were discarded
+	Interrupted []string
+	// Rx versions and excluded files of each archive, shared by all distributions
+	Versions   *VersionsReport
+	Exclusions *ExclusionReport
+	// files importing confounding libraries along with the distributions (only when reported)
+	CoImports *CoImportReport
+}
+
+func NewRunResults() *RunResults {
+	return &RunResults{Distributions: make(map[string]*Results), Quarantined: make(map[string]string),
+		Versions: NewVersionsReport(), Exclusions: NewExclusionReport()}
+}
+
+// adds the results of a distribution; all of them must have an entry for the same archives
+func (run *RunResults) Add(dist string, results *Results) {
+	run.Order = append(run.Order, dist)
+	run.Distributions[dist] = results
+}
+
+// returns the archives the results have an entry for
+func (run *RunResults) Archives() []string {
+	if len(run.Order) == 0 {
+		return nil
 	}
-	regDist := regexp.MustCompile(regDistPattern)
-	for i = 0; i < config.PROCESSING_WORKERS; i++ {
-		outChannels[i] = checkImport(out, regDist)
+	return run.Distributions[run.Order[0]].Counts.Keys()
+}
+
+// keeps only the entries of the archives accepted by keep, e.g. the ones finished
+// before a cancellation
+func (run *RunResults) Retain(keep func(archive string) bool) {
+	// Keys returns the map's own slice, changed by Delete
+	archives := append([]string{}, run.Archives()...)
+	for _, archive := range archives {
+		if keep(archive) {
+			continue
+		}
+		for _, results := range run.Distributions {
+			results.Counts.Delete(archive)
+			results.CountsByClass.Delete(archive)
+			results.CountsByLanguage.Delete(archive)
+		}
 	}
-	out = util.MergeChannels(outChannels...)
+}
 
-	for i = 0; i < config.PROCESSING_WORKERS; i++ {
-		outChannels[i] = removeStrings(out)
+// distributions used together in the archives: an archive uses a distribution when
+// any of its operators is counted in it
+type MixedUsage struct {
+	// archive -> distributions used
+	Archives *orderedmap.OrderedMap `json:"archives"`
+	// distributions joined by + -> number of archives using exactly them
+	Combinations map[string]int `json:"combinations"`
+}
+
+func (run *RunResults) MixedUsage() *MixedUsage {
+	mixed := &MixedUsage{Archives: orderedmap.New(), Combinations: make(map[string]int)}
+	for _, archive := range run.Archives() {
+		var used []string
+		for _, dist := range run.Order {
+			v, _ := run.Distributions[dist].Counts.Get(archive)
+			entry := v.(*orderedmap.OrderedMap)
+			for _, op := range entry.Keys() {
+				if v, _ := entry.Get(op); v.(int) > 0 {
+					used = append(used, dist)
+					break
+				}
+			}
+		}
+		if len(used) > 0 {
+			mixed.Archives.Set(archive, used)
+			mixed.Combinations[strings.Join(used, "+")]++
+		}
 	}
-	out = util.MergeChannels(outChannels...)
+	return mixed
+}
 
-	dispatchToOpsCounters(out, inOps)
+// progress of an archive through the pipeline
+type archiveProgress struct {
+	// files counted or skipped so far
+	files int
+	done  *types.ArchiveDoneMsg
+}
 
-	return gatherResults(outOps, result)
+// outcome of the operators pipeline
+type PipelineResult struct {
+	// files counted
+	Files int
+	// first error writing the occurrences or the checkpoint (the files still being counted)
+	// or of the pipeline's stages
+	Err error
 }
 
-func processArchives(dist string) <-chan interface{} {
-	out := make(chan interface{})
+// counts the operators of every distribution given in a single pass over the archives
+// each file is counted for the distributions it imports; once ctx is cancelled, no archive
+// is started and the ones being read are interrupted (see RunResults.Interrupted)
+func SetupOpsPipeline(ctx context.Context, sources []ArchiveSource, languages *LanguageClassifier,
+	operators []*types.Operators, opts *Options, run *RunResults) <-chan PipelineResult {
+	var dists []string
+	distOperators := make(map[string]*types.Operators)
+	for _, ops := range operators {
+		ops.TrackOccurrences = opts.OccurrencesPath != ""
+		dists = append(dists, ops.Dist)
+		distOperators[ops.Dist] = ops
+	}
 
-	archives, err := os.ReadDir(filepath.Join(config.REPO_RETRIVAL_PATH, dist, config.ARCHIVES_FOLDER))
-	util.CheckError(err)
+	p := pipeline.New(ctx, opts.Progress)
+	out := SetupContentPipeline(p, sources, languages, opts, run, dists...)
 
-	go func() {
-		for _, val := range archives {
-			out <- val
+	// each file is scanned once for all operators
+	out = pipeline.Stage(p, "operators", config.PROCESSING_WORKERS, out,
+		countOperators(distOperators, opts.ExtractChains))
+	opts.Progress.AddQueue("results", func() int { return len(out) })
+
+	return gatherResults(p, out, opts, run)
+}
+
+// state shared by the stages reading the archives of a run
+type contentStages struct {
+	opts      *Options
+	run       *RunResults
+	languages *LanguageClassifier
+	dists     []string
+	// matchers of the modules of each distribution, indexed as dists
+	isDistModule []func(types.Import) bool
+}
+
+// adds to p the stages reading the archives and emitting the content of the files that
+// import any of the distributions, with comments and strings already removed; the archives
+// stop being read once p is cancelled, their ArchiveDoneMsg carrying the context's error
+// the versions, exclusions and co-imports found are added to run
+func SetupContentPipeline(p *pipeline.Pipeline, sources []ArchiveSource, languages *LanguageClassifier,
+	opts *Options, run *RunResults, dists ...string) <-chan types.FileMsg {
+	s := &contentStages{opts: opts, run: run, languages: languages, dists: dists,
+		isDistModule: make([]func(types.Import) bool, len(dists))}
+	for i, dist := range dists {
+		s.isDistModule[i] = DistributionModuleMatcher(dist)
+	}
+
+	out := pipeline.Stage(p, "archives", config.PROCESSING_WORKERS, pipeline.Source(p, sources), s.processArchive)
+	out = pipeline.Stage(p, "comments", config.PROCESSING_WORKERS, out, removeComments)
+	// check imports before removing strings to avoid not matching
+	// string paths of the imports (JS)
+	out = pipeline.Stage(p, "imports", config.PROCESSING_WORKERS, out, s.checkImport)
+	return pipeline.Stage(p, "strings", config.PROCESSING_WORKERS, out, removeStrings)
+}
+
+// versions found when several distributions are searched are tagged with their distribution
+func distVersions(versions []types.RxVersion, dist string, dists []string) []types.RxVersion {
+	if len(dists) > 1 {
+		for i := range versions {
+			versions[i].Distribution = dist
 		}
-		close(out)
-	}()
-	return out
+	}
+	return versions
 }
 
-func processArchive(in <-chan interface{},
-	allowedExtensions map[string]struct{}, dist string) <-chan interface{} {
-	out := make(chan interface{})
-	go func() {
-		for val := range in {
-			entry := val.(fs.DirEntry)
+// indicates if the path is excluded for any of the distributions, adding it to the exclusions if so
+func (s *contentStages) excludedPath(archive, filePath string, attrs *gitAttributes) bool {
+	for _, dist := range s.dists {
+		if category := classifyPath(filePath, dist, attrs); category != NOT_EXCLUDED {
+			s.run.Exclusions.Add(archive, category)
+			return true
+		}
+	}
+	return false
+}
 
-			file, err := os.Open(filepath.Join(config.REPO_RETRIVAL_PATH, dist,
-				config.ARCHIVES_FOLDER, entry.Name()))
-			util.CheckError(err)
+// indicates if the content is excluded for any of the distributions, adding it to the exclusions if so
+func (s *contentStages) excludedContent(archive, filePath, content string, attrs *gitAttributes) bool {
+	for _, dist := range s.dists {
+		if category := classifyContent(filePath, content, dist, attrs); category != NOT_EXCLUDED {
+			s.run.Exclusions.Add(archive, category)
+			return true
+		}
+	}
+	return false
+}
 
-			archive, err := gzip.NewReader(file)
-			util.CheckError(err)
+// emits the files of an archive, followed by its end
+func (s *contentStages) processArchive(ctx context.Context, source ArchiveSource, emit func(types.FileMsg)) error {
+	attrs := &gitAttributes{}
+	files := 0
 
-			tr := tar.NewReader(archive)
+	err := source.Walk(func(file SourceFile) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		filePath := file.Path
+		if path.Base(filePath) == ".gitattributes" {
+			bs, err := ioutil.ReadAll(file.Content)
+			if err != nil {
+				return err
+			}
+			attrs.Parse(filePath, string(bs))
+			return nil
+		}
+		// manifests and lockfiles are read to detect the Rx version
+		manifest := isManifest(filePath) && !inVendorDir(filePath)
+		reader := bufio.NewReader(file.Content)
+		// check if it may be of a searched language before reading its content
+		allowed := s.languages.Candidate(filePath, reader)
+		// files without extension are only checked once their language is known
+		hasExt := path.Ext(filePath) != ""
+		if allowed && hasExt && !s.opts.KeepExcludedFiles {
+			allowed = !s.excludedPath(source.Name(), filePath, attrs)
+		}
+		if !allowed && !manifest {
+			return nil
+		}
+		//uncomment it to see info about the file being processed
+		//log.Printf("Processing file %s from %s\n", file.Name, source.Name())
+		bs, err := ioutil.ReadAll(reader)
+		if err != nil { // check for errors
+			log.Printf("Repository:%s, File:%s\n", source.Name(), file.Name)
+			return err
+		}
 
-			for {
-				hdr, err := tr.Next()
-				if err == io.EOF { //no more files to process
-					break
-				}
-				util.CheckError(err)
-
-				// regular file
-				if hdr.Typeflag == tar.TypeReg {
-					// check if it is in the list of allowed extensions before reading its content
-					if _, ok := allowedExtensions[filepath.Ext(hdr.Name)]; ok {
-						//uncomment it to see info about the file being processed
-						//log.Printf("Processing file %s from %s\n", hdr.Name, entry.Name())
-						bs, err := ioutil.ReadAll(tr)
-						if err != nil { // check for errors
-							log.Printf("Repository:%s, File:%s\n", entry.Name(), hdr.Name)
-							log.Fatal(err)
-						}
-
-						//uncomment it to check file's content
-						//log.Println(string(bs))
-						out <- types.ContentMsg{FileName: entry.Name(),
-							InnerFileName: hdr.Name, FileContent: string(bs)}
-					}
-				}
+		//uncomment it to check file's content
+		//log.Println(string(bs))
+		content := string(bs)
+		if manifest {
+			for _, dist := range s.dists {
+				s.run.Versions.Add(source.Name(), distVersions(parseManifest(filePath, content, dist), dist, s.dists)...)
 			}
-			file.Close()
 		}
-		close(out)
-	}()
-	return out
+		if !allowed {
+			return nil
+		}
+		language, ok := s.languages.Classify(filePath, content)
+		if !ok {
+			return nil
+		}
+		if !hasExt && !s.opts.KeepExcludedFiles && s.excludedPath(source.Name(), filePath, attrs) {
+			return nil
+		}
+		if !s.opts.KeepExcludedFiles && s.excludedContent(source.Name(), filePath, content, attrs) {
+			return nil
+		}
+		if !utf8.ValidString(content) {
+			// same conversion done by regexp2, so offsets agree across stages
+			content = string([]rune(content))
+		}
+		emit(types.FileMsg{Content: &types.ContentMsg{FileName: source.Name(), InnerFileName: file.Name,
+			Path: filePath, Language: language, FileContent: content, Source: content}})
+		files++
+		return nil
+	})
+	emit(types.FileMsg{Done: &types.ArchiveDoneMsg{FileName: source.Name(), Files: files, Err: err}})
+	return nil
 }
 
-func removeComments(in <-chan interface{}, commentsReg *regexp2.Regexp) <-chan interface{} {
-	out := make(chan interface{})
-	go func() {
-		for msg := range in {
-			t := msg.(types.ContentMsg)
-			// replace comments by space(s)
-			t.FileContent, _ = commentsReg.Replace(t.FileContent, "$2 ", -1, -1)
-			out <- t
-		}
-		close(out)
-	}()
-	return out
+// each worker takes its own regex to avoid possible contention
+// given the complexity of the regular expression
+var commentsRegs = sync.Pool{New: func() interface{} { return regexp2.MustCompile(commentsPattern, 0) }}
+
+func removeComments(_ context.Context, msg types.FileMsg, emit func(types.FileMsg)) error {
+	if t := msg.Content; t != nil {
+		commentsReg := commentsRegs.Get().(*regexp2.Regexp)
+		defer commentsRegs.Put(commentsReg)
+		// replace comments by a space, and the code by itself followed by a space ("$2 ")
+		replaceContent(t, commentsReg, func(m *regexp2.Match) (bool, string) {
+			comment := m.GroupByNumber(1)
+			return comment == nil || comment.Length == 0, " "
+		})
+	}
+	emit(msg)
+	return nil
 }
 
-func removeStrings(in <-chan interface{}) <-chan interface{} {
-	out := make(chan interface{})
-	go func() {
-		for msg := range in {
-			t := msg.(types.ContentMsg)
-			// replace strings by empty string
-			t.FileContent, _ = stringsReg.Replace(t.FileContent, "", -1, -1)
-			out <- t
+func removeStrings(_ context.Context, msg types.FileMsg, emit func(types.FileMsg)) error {
+	if t := msg.Content; t != nil {
+		// replace strings by empty string
+		replaceContent(t, stringsReg, func(*regexp2.Match) (bool, string) {
+			return false, ""
+		})
+	}
+	emit(msg)
+	return nil
+}
+
+// replaces each match of re in the content of t by itself, if repl keeps it, followed by
+// the text repl inserts, recording how the offsets of the new content map to the old ones
+func replaceContent(t *types.ContentMsg, re *regexp2.Regexp, repl func(m *regexp2.Match) (keep bool, insert string)) {
+	s := t.FileContent
+	var b strings.Builder
+	b.Grow(len(s))
+	om := &types.OffsetMap{}
+	// regexp2 works with runes, so the matches' indexes are converted to bytes as they come
+	runeOffset, byteOffset := 0, 0
+	toBytes := func(index int) int {
+		for ; runeOffset < index; runeOffset++ {
+			_, size := utf8.DecodeRuneInString(s[byteOffset:])
+			byteOffset += size
 		}
-		close(out)
-	}()
-	return out
+		return byteOffset
+	}
+	last := 0
+	m, _ := re.FindStringMatch(s)
+	for m != nil {
+		start := toBytes(m.Index)
+		end := toBytes(m.Index + m.Length)
+		if start > last {
+			om.Copy(b.Len(), last)
+			b.WriteString(s[last:start])
+		}
+		keep, insert := repl(m)
+		if keep {
+			om.Copy(b.Len(), start)
+			b.WriteString(s[start:end])
+		}
+		b.WriteString(insert)
+		last = end
+		m, _ = re.FindNextMatch(m)
+	}
+	if last < len(s) {
+		om.Copy(b.Len(), last)
+		b.WriteString(s[last:])
+	}
+	t.FileContent = b.String()
+	t.AddOffsetMap(om)
 }
 
-func checkImport(in <-chan interface{}, reg *regexp.Regexp) <-chan interface{} {
-	out := make(chan interface{})
-	counts := []int{}
-	go func() {
-		for msg := range in {
-			t := msg.(types.ContentMsg)
-			if reg.MatchString(t.FileContent) {
-				if CheckFalsePositives {
-					// checks imports of Java collection-like libs
-					for i, inspectedLib := range InspectedLibs {
-						if inspectedLib.Regex.MatchString(t.FileContent) {
-							fmt.Println(t.InnerFileName)
-							counts[i]++
-						}
-					}
-				}
-				out <- t
-			}
+// parses the import statements of each file and only lets through
+// files that actually import the distribution
+func (s *contentStages) checkImport(_ context.Context, msg types.FileMsg, emit func(types.FileMsg)) error {
+	t := msg.Content
+	if t == nil { // end of archive and skipped files
+		emit(msg)
+		return nil
+	}
+	t.Imports = ParseImports(t.InnerFileName, t.FileContent)
+	for i, dist := range s.dists {
+		distImports := distributionImports(t.Imports, s.isDistModule[i])
+		if len(distImports) == 0 {
+			continue
 		}
-		if CheckFalsePositives {
-			for i, inspectedLib := range InspectedLibs {
-				fmt.Printf("%s File Count: %d\n", inspectedLib.Name, counts[i])
+		t.Distributions = append(t.Distributions, dist)
+		if aliases := t.ImportedAliases(s.isDistModule[i]); aliases != nil {
+			if t.Aliases == nil {
+				t.Aliases = make(map[string]map[string]string)
 			}
+			t.Aliases[dist] = aliases
 		}
-		close(out)
-	}()
-	return out
+		if s.run.CoImports != nil {
+			s.run.CoImports.Add(dist, t)
+		}
+		for _, major := range importedMajors(distImports, dist) {
+			s.run.Versions.Add(t.FileName, distVersions(
+				[]types.RxVersion{{Major: major, Source: IMPORTS_SOURCE}}, dist, s.dists)...)
+		}
+	}
+	if len(t.Distributions) > 0 {
+		t.FileClass = classifyFile(t.Path, t.Imports)
+		emit(msg)
+	} else {
+		emit(types.FileMsg{Skipped: &types.FileSkippedMsg{FileName: t.FileName}})
+	}
+	return nil
 }
 
-// broadcast to operator counters(workers)
-func dispatchToOpsCounters(in <-chan interface{}, inOps []chan types.ContentMsg) {
-	go func() {
-		for msg := range in {
-			t := msg.(types.ContentMsg)
-			for _, inOp := range inOps {
-				inOp <- t
+// emits the counts of a file for each distribution it imports
+func countOperators(operators map[string]*types.Operators,
+	chains bool) func(context.Context, types.FileMsg, func(types.FileMsg)) error {
+	return func(_ context.Context, msg types.FileMsg, emit func(types.FileMsg)) error {
+		t := msg.Content
+		if t == nil { // end of archive and skipped files
+			emit(msg)
+			return nil
+		}
+		countMsgs := make([]types.CountMsg, 0, len(t.Distributions))
+		for _, dist := range t.Distributions {
+			ops := operators[dist]
+			offsets := ops.Match(t.FileContent, t.Language)
+			ops.MatchAliases(t.FileContent, t.Aliases[dist], offsets)
+			countMsg := types.CountMsg{Distribution: dist, FileName: t.FileName,
+				InnerFileName: t.InnerFileName, FileClass: t.FileClass, Language: t.Language, Counts: ops.CountOffsets(t, offsets)}
+			if chains {
+				countMsg.Chains = extractChains(t.FileContent, offsets, ops.GetOperators())
 			}
+			countMsgs = append(countMsgs, countMsg)
 		}
-		// closes all channels when done
-		types.CloseAllInOps(inOps)
-	}()
+		emit(types.FileMsg{Counts: countMsgs})
+		return nil
+	}
 }
 
-func gatherResults(outOps <-chan interface{}, result *orderedmap.OrderedMap) <-chan int {
-	out := make(chan int)
+// returns the operators count of a file class in an archive, creating it when needed
+func getClassEntry(countsByClass *orderedmap.OrderedMap, archive, class string,
+	operators []string) *orderedmap.OrderedMap {
+	v, ok := countsByClass.Get(archive)
+	if !ok {
+		v = orderedmap.New()
+		countsByClass.Set(archive, v)
+	}
+	archiveEntry := v.(*orderedmap.OrderedMap)
+	v, ok = archiveEntry.Get(class)
+	if !ok {
+		classEntry := orderedmap.New()
+		for _, op := range operators {
+			classEntry.Set(op, 0)
+		}
+		archiveEntry.Set(class, classEntry)
+		return classEntry
+	}
+	return v.(*orderedmap.OrderedMap)
+}
+
+// counts the files coming out of the pipeline p until it finishes
+func gatherResults(p *pipeline.Pipeline, in <-chan types.FileMsg, opts *Options, run *RunResults) <-chan PipelineResult {
+	out := make(chan PipelineResult)
 	go func() {
-		countFiles := 0
-		for msg := range outOps {
-			countMsg := msg.(types.CountMsg)
-			v, _ := result.Get(countMsg.FileName)
-			mapEntry := v.(*orderedmap.OrderedMap)
-			v, _ = mapEntry.Get(countMsg.OperatorCount.Operator)
-			count := v.(int)
-			mapEntry.Set(countMsg.OperatorCount.Operator,
-				count+countMsg.OperatorCount.Total)
-			countFiles++
-			if CheckFalsePositives {
-				// accumulates total of operators occurrences in files w/ collection-like libs' imports
-				// used for checking of Java collection-like libs
-				// extremely usabled for sample inspection
-				if elem, ok := FilesMap[countMsg.InnerFileName]; ok {
-					if countMsg.OperatorCount.Total > 0 {
-						elem.Set(countMsg.OperatorCount.Operator, countMsg.OperatorCount.Total)
-					}
+		var (
+			occurrencesFile   *os.File
+			occurrencesWriter *bufio.Writer
+			occurrences       *json.Encoder
+			// first error, the pipeline being drained anyway
+			firstErr error
+		)
+		fail := func(err error) {
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if opts.OccurrencesPath != "" {
+			flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+			if run.Checkpoint != nil && run.Checkpoint.Resumed() {
+				// keeps the occurrences of the archives finished by previous runs
+				flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+			}
+			var err error
+			occurrencesFile, err = os.OpenFile(opts.OccurrencesPath, flags, 0644)
+			if err != nil {
+				fail(fmt.Errorf("opening the occurrences file: %w", err))
+			} else {
+				occurrencesWriter = bufio.NewWriter(occurrencesFile)
+				occurrences = json.NewEncoder(occurrencesWriter)
+				occurrences.SetEscapeHTML(false)
+			}
+		}
+
+		progress := make(map[string]*archiveProgress)
+		// checks if all files of an archive went through the pipeline, checkpointing it if so
+		checkArchive := func(archive string) {
+			p := progress[archive]
+			if p.done == nil || p.files < p.done.Files {
+				return
+			}
+			delete(progress, archive)
+			opts.Progress.AddDone(1)
+			if occurrences != nil {
+				fail(occurrencesWriter.Flush())
+			}
+			if errors.Is(p.done.Err, context.Canceled) {
+				interrupt(run, archive)
+				return
+			}
+			if p.done.Err != nil {
+				quarantine(run, archive, p.done.Err)
+				if run.Checkpoint != nil {
+					fail(run.Checkpoint.Append(
+						&ArchiveCheckpoint{Archive: archive, Error: p.done.Err.Error(), Files: p.files}))
 				}
+				return
+			}
+			if run.Checkpoint != nil {
+				fail(run.Checkpoint.Append(archiveCheckpoints(run, archive, p.files)...))
+			}
+			for _, results := range run.Distributions {
+				results.commit(archive)
+			}
+			if run.CoImports != nil {
+				run.CoImports.Commit(archive)
 			}
 		}
+		getProgress := func(archive string) *archiveProgress {
+			p, ok := progress[archive]
+			if !ok {
+				p = &archiveProgress{}
+				progress[archive] = p
+			}
+			return p
+		}
 
-		if CheckFalsePositives {
-			// saves ops' count from files w/ collection-like libs' imports in a pretty JSON file
-			// used to facilitate the looking for false positives in those files
-			util.WritePrettyJSON(filepath.Join(config.FALSE_POSITIVES_PATH, "collection-like_count"),
-				FilesMap)
+		countFiles := 0
+		for msg := range in {
+			switch {
+			case msg.Done != nil:
+				getProgress(msg.Done.FileName).done = msg.Done
+				checkArchive(msg.Done.FileName)
+				continue
+			case msg.Skipped != nil:
+				getProgress(msg.Skipped.FileName).files++
+				checkArchive(msg.Skipped.FileName)
+				continue
+			}
+			countMsgs := msg.Counts
+			for _, countMsg := range countMsgs {
+				fail(addCounts(run.Distributions[countMsg.Distribution], countMsg, occurrences))
+			}
+			// a file is counted once no matter how many distributions it imports
+			archive := countMsgs[0].FileName
+			countFiles++
+			opts.Progress.AddFiles(1)
+			getProgress(archive).files++
+			checkArchive(archive)
 		}
 
-		// sort results
-		result.SortKeys(sort.Strings)
-		// sort each entry by operators' name
-		for _, k := range result.Keys() {
-			v, _ := result.Get(k)
-			entry := v.(*orderedmap.OrderedMap)
-			entry.SortKeys(sort.Strings)
+		if occurrences != nil {
+			fail(occurrencesWriter.Flush())
+			fail(occurrencesFile.Close())
 		}
-		out <- countFiles
+		fail(p.Wait())
+
+		for _, results := range run.Distributions {
+			sortResults(results)
+		}
+		out <- PipelineResult{Files: countFiles, Err: firstErr}
 		close(out)
 	}()
 	return out
 }
+
+// adds the counts of a file to the results of its distribution, writing its occurrences;
+// the counts are added even if the occurrences fail to be written
+func addCounts(results *Results, countMsg types.CountMsg, occurrences *json.Encoder) error {
+	var err error
+	v, _ := results.Counts.Get(countMsg.FileName)
+	mapEntry := v.(*orderedmap.OrderedMap)
+	classEntry := getClassEntry(results.CountsByClass, countMsg.FileName, countMsg.FileClass, mapEntry.Keys())
+	langEntry := getClassEntry(results.CountsByLanguage, countMsg.FileName, countMsg.Language, mapEntry.Keys())
+	for _, opCount := range countMsg.Counts {
+		v, _ = mapEntry.Get(opCount.Operator)
+		count := v.(int)
+		mapEntry.Set(opCount.Operator, count+opCount.Total)
+		v, _ = classEntry.Get(opCount.Operator)
+		classEntry.Set(opCount.Operator, v.(int)+opCount.Total)
+		v, _ = langEntry.Get(opCount.Operator)
+		langEntry.Set(opCount.Operator, v.(int)+opCount.Total)
+		if occurrences != nil {
+			// one JSON object per line
+			for _, occurrence := range opCount.Occurrences {
+				if encodeErr := occurrences.Encode(occurrence); encodeErr != nil && err == nil {
+					err = fmt.Errorf("writing the occurrences: %w", encodeErr)
+				}
+			}
+		}
+	}
+	if results.NGrams != nil {
+		results.archiveNGrams(countMsg.FileName).Add(countMsg.Chains)
+	}
+	if results.CoOccurrences != nil {
+		var used []int
+		for i, opCount := range countMsg.Counts {
+			if opCount.Total > 0 {
+				used = append(used, i)
+			}
+		}
+		results.CoOccurrences.AddFile(countMsg.FileName, used)
+	}
+	return err
+}
+
+// sorts the results by archive and operators' name
+func sortResults(results *Results) {
+	results.Counts.SortKeys(sort.Strings)
+	// sort each entry by operators' name
+	for _, k := range results.Counts.Keys() {
+		v, _ := results.Counts.Get(k)
+		entry := v.(*orderedmap.OrderedMap)
+		entry.SortKeys(sort.Strings)
+	}
+	sortBreakdown(results.CountsByClass)
+	sortBreakdown(results.CountsByLanguage)
+}
+
+// sorts counts split by archive and class (or language) by their keys
+func sortBreakdown(breakdown *orderedmap.OrderedMap) {
+	breakdown.SortKeys(sort.Strings)
+	for _, k := range breakdown.Keys() {
+		v, _ := breakdown.Get(k)
+		entry := v.(*orderedmap.OrderedMap)
+		entry.SortKeys(sort.Strings)
+		for _, class := range entry.Keys() {
+			v, _ := entry.Get(class)
+			v.(*orderedmap.OrderedMap).SortKeys(sort.Strings)
+		}
+	}
+}
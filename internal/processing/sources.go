@@ -0,0 +1,282 @@
+package processing
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/carloszimm/github-mining/internal/config"
+)
+
+// source of the files of a repository to be analysed
+type ArchiveSource interface {
+	// name identifying the repository in the results
+	Name() string
+	// calls fn for each regular file of the repository, stopping at the first error
+	Walk(fn func(file SourceFile) error) error
+}
+
+// regular file of an archive source
+type SourceFile struct {
+	// path as stored in the source (e.g. with the top folder of the tarballs)
+	Name string
+	// path relative to the repository root
+	Path    string
+	Content io.Reader
+}
+
+// names of the kinds of sources accepted by ParseSources
+const (
+	ARCHIVES_SOURCE = "archives"
+	DIR_SOURCE      = "dir"
+	GIT_SOURCE      = "git"
+	ZIP_SOURCE      = "zip"
+	TGZ_SOURCE      = "tgz"
+)
+
+// tarball (.tar.gz) downloaded by repo-retrieval
+type tarGzSource struct {
+	path string
+}
+
+func (s *tarGzSource) Name() string {
+	return filepath.Base(s.path)
+}
+
+func (s *tarGzSource) Walk(fn func(file SourceFile) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	return walkTar(archive, true, fn)
+}
+
+// walks the regular files of a tar stream; the GitHub tarballs wrap the
+// repository in a top folder, stripped from the paths when topFolder is set
+func walkTar(r io.Reader, topFolder bool, fn func(file SourceFile) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF { //no more files to process
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		filePath := hdr.Name
+		if topFolder {
+			filePath = repoPath(hdr.Name)
+		}
+		if err := fn(SourceFile{Name: hdr.Name, Path: filePath, Content: tr}); err != nil {
+			return err
+		}
+	}
+}
+
+// directory tree, e.g. a local checkout; .git folders are skipped
+type dirSource struct {
+	root string
+}
+
+func (s *dirSource) Name() string {
+	return filepath.Base(filepath.Clean(s.root))
+}
+
+func (s *dirSource) Walk(fn func(file SourceFile) error) error {
+	return filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		rel = filepath.ToSlash(rel)
+		return fn(SourceFile{Name: rel, Path: rel, Content: file})
+	})
+}
+
+// git repository (bare or not) at a given ref, read through git archive
+type gitSource struct {
+	repo, ref string
+}
+
+func (s *gitSource) Name() string {
+	return fmt.Sprintf("%s@%s", strings.TrimSuffix(filepath.Base(filepath.Clean(s.repo)), ".git"), s.ref)
+}
+
+func (s *gitSource) Walk(fn func(file SourceFile) error) error {
+	cmd := exec.Command("git", "--git-dir", s.gitDir(), "archive", "--format=tar", s.ref)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := walkTar(stdout, false, fn); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git archive %s of %s: %v: %s", s.ref, s.repo, err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// the repository itself if bare, otherwise its .git folder
+func (s *gitSource) gitDir() string {
+	if info, err := os.Stat(filepath.Join(s.repo, ".git")); err == nil && info.IsDir() {
+		return filepath.Join(s.repo, ".git")
+	}
+	return s.repo
+}
+
+// zip file; as in the GitHub zipballs, a top folder common to all files is stripped
+type zipSource struct {
+	path string
+}
+
+func (s *zipSource) Name() string {
+	return filepath.Base(s.path)
+}
+
+func (s *zipSource) Walk(fn func(file SourceFile) error) error {
+	zr, err := zip.OpenReader(s.path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	top := zipTopFolder(zr.File)
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		content, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(SourceFile{Name: f.Name, Path: strings.TrimPrefix(f.Name, top), Content: content})
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns the folder (with a trailing slash) containing every file of the zip, if any
+func zipTopFolder(files []*zip.File) string {
+	top := ""
+	for _, f := range files {
+		i := strings.IndexByte(f.Name, '/')
+		if i < 0 {
+			return ""
+		}
+		if top == "" {
+			top = f.Name[:i+1]
+		} else if f.Name[:i+1] != top {
+			return ""
+		}
+	}
+	return top
+}
+
+// returns the archives downloaded by repo-retrieval for the distribution
+func RetrievedArchives(dist string) ([]ArchiveSource, error) {
+	dir := filepath.Join(config.REPO_RETRIVAL_PATH, dist, config.ARCHIVES_FOLDER)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]ArchiveSource, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			sources = append(sources, &tarGzSource{filepath.Join(dir, entry.Name())})
+		}
+	}
+	return sources, nil
+}
+
+// parses comma-separated sources specifications:
+//
+//	archives           the archives downloaded by repo-retrieval for the distribution
+//	dir:<path>         a directory tree (e.g. a local checkout)
+//	git:<path>@<ref>   a (bare) git repository at the given ref (HEAD if omitted)
+//	zip:<path>         a zip file
+//	tgz:<path>         a tarball (.tar.gz) with a top folder, as the ones from GitHub
+func ParseSources(specs, dist string) ([]ArchiveSource, error) {
+	var sources []ArchiveSource
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		kind, location := spec, ""
+		if i := strings.IndexByte(spec, ':'); i >= 0 {
+			kind, location = spec[:i], spec[i+1:]
+		}
+		if kind != ARCHIVES_SOURCE && location == "" {
+			return nil, fmt.Errorf("source %q without a path", spec)
+		}
+		switch kind {
+		case ARCHIVES_SOURCE:
+			archives, err := RetrievedArchives(dist)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, archives...)
+		case DIR_SOURCE:
+			sources = append(sources, &dirSource{location})
+		case GIT_SOURCE:
+			repo, ref := location, "HEAD"
+			if i := strings.LastIndexByte(location, '@'); i > 0 {
+				repo, ref = location[:i], location[i+1:]
+			}
+			sources = append(sources, &gitSource{repo, ref})
+		case ZIP_SOURCE:
+			sources = append(sources, &zipSource{location})
+		case TGZ_SOURCE:
+			sources = append(sources, &tarGzSource{location})
+		default:
+			return nil, fmt.Errorf("unknown kind of source %q in %q", kind, spec)
+		}
+	}
+	return sources, nil
+}
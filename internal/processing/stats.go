@@ -0,0 +1,189 @@
+package processing
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// percentiles of the operators' counts per repository reported in the summary
+var StatsPercentiles = []float64{25, 75, 90, 95}
+
+// summary statistics of an operator over the repositories searched
+type OperatorStats struct {
+	Operator string `json:"operator"`
+	Total    int    `json:"total"`
+	// number and percentage of repositories using the operator at least once
+	Repositories int     `json:"repositories"`
+	Percentage   float64 `json:"percentage"`
+	// statistics of the operator's count per repository (all repositories, even the ones not using it)
+	Mean        float64            `json:"mean"`
+	Median      float64            `json:"median"`
+	Percentiles map[string]float64 `json:"percentiles"`
+	Max         int                `json:"max"`
+	// concentration of the operator's usage across the repositories (0 even, 1 a single repository)
+	Gini float64 `json:"gini"`
+}
+
+// statistical summary of an operator-search result
+type StatsSummary struct {
+	Repositories int `json:"repositories"`
+	// repositories using at least one operator
+	RxRepositories int `json:"rxRepositories"`
+	Total          int `json:"total"`
+	// number of operators used at least once
+	OperatorsUsed int `json:"operatorsUsed"`
+	// concentration of the usage across the operators
+	Gini      float64          `json:"gini"`
+	Operators []*OperatorStats `json:"operators"`
+}
+
+// summarizes a result (archive -> operator -> count) in which every archive has an entry
+// for all operators; the operators are sorted by name
+func Summarize(result map[string]map[string]int) *StatsSummary {
+	counts := make(map[string][]types.OperatorCount, len(result))
+	rxRepositories := 0
+	for archive, entry := range result {
+		used := false
+		for op, total := range entry {
+			counts[archive] = append(counts[archive], types.OperatorCount{Operator: op, Total: total})
+			used = used || total > 0
+		}
+		if used {
+			rxRepositories++
+		}
+	}
+
+	summary := &StatsSummary{Repositories: len(result), RxRepositories: rxRepositories}
+	var totals []types.OperatorCount
+	for op, perRepo := range types.AggregateByOperator(counts) {
+		totals = append(totals, types.OperatorCount{Operator: op, Total: sum(perRepo)})
+		summary.Operators = append(summary.Operators, operatorStats(op, perRepo))
+	}
+	types.SortOperatorsCount(totals)
+	sort.Slice(summary.Operators, func(i, j int) bool {
+		return summary.Operators[i].Operator < summary.Operators[j].Operator
+	})
+
+	opTotals := make([]int, len(totals))
+	for i, opCount := range totals {
+		opTotals[i] = opCount.Total
+		summary.Total += opCount.Total
+		if opCount.Total > 0 {
+			summary.OperatorsUsed++
+		}
+	}
+	summary.Gini = gini(opTotals)
+	return summary
+}
+
+func operatorStats(op string, perRepo []int) *OperatorStats {
+	sorted := append([]int(nil), perRepo...)
+	sort.Ints(sorted)
+	stats := &OperatorStats{Operator: op, Total: sum(sorted), Median: percentile(sorted, 50),
+		Percentiles: make(map[string]float64), Gini: gini(sorted)}
+	for _, count := range sorted {
+		if count > 0 {
+			stats.Repositories++
+		}
+	}
+	if n := len(sorted); n > 0 {
+		stats.Percentage = 100 * float64(stats.Repositories) / float64(n)
+		stats.Mean = float64(stats.Total) / float64(n)
+		stats.Max = sorted[n-1]
+	}
+	for _, p := range StatsPercentiles {
+		stats.Percentiles[percentileName(p)] = percentile(sorted, p)
+	}
+	return stats
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// p-th percentile of sorted values, linearly interpolated between the closest ranks
+func percentile(sorted []int, p float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(n-1)
+	lower := int(math.Floor(rank))
+	if lower >= n-1 {
+		return float64(sorted[n-1])
+	}
+	return float64(sorted[lower]) + (rank-float64(lower))*float64(sorted[lower+1]-sorted[lower])
+}
+
+func percentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// Gini coefficient of the values (0 when all are equal or all are zero)
+func gini(values []int) float64 {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	n := float64(len(sorted))
+	total, weighted := 0.0, 0.0
+	for i, v := range sorted {
+		total += float64(v)
+		weighted += float64(i+1) * float64(v)
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2*weighted/(n*total) - (n+1)/n
+}
+
+// writes the summary to <path>.json and a row per operator to <path>.csv
+func (s *StatsSummary) Write(path string) error {
+	if err := util.WritePrettyJSON(path, s); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path + ".csv")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+
+	header := []string{"operator", "total", "repositories", "percentage", "mean", "median"}
+	for _, p := range StatsPercentiles {
+		header = append(header, percentileName(p))
+	}
+	header = append(header, "max", "gini")
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, op := range s.Operators {
+		row := []string{op.Operator, strconv.Itoa(op.Total), strconv.Itoa(op.Repositories),
+			formatFloat(op.Percentage), formatFloat(op.Mean), formatFloat(op.Median)}
+		for _, p := range StatsPercentiles {
+			row = append(row, formatFloat(op.Percentiles[percentileName(p)]))
+		}
+		row = append(row, strconv.Itoa(op.Max), formatFloat(op.Gini))
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
@@ -0,0 +1,34 @@
+package processing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGini(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		want   float64
+	}{
+		{"equal", []int{3, 3, 3, 3}, 0},
+		{"all zero", []int{0, 0, 0}, 0},
+		{"single", []int{5}, 0},
+		{"one holds all", []int{0, 0, 0, 10}, 0.75},
+		{"unsorted", []int{3, 1, 2}, 2.0 / 9},
+	}
+	for _, tt := range tests {
+		if got := gini(tt.values); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: gini(%v) = %v, want %v", tt.name, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []int{1, 2, 3, 4}
+	for p, want := range map[float64]float64{0: 1, 50: 2.5, 100: 4, 90: 3.7} {
+		if got := percentile(sorted, p); math.Abs(got-want) > 1e-9 {
+			t.Errorf("percentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+}
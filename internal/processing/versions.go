@@ -0,0 +1,335 @@
+package processing
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/carloszimm/github-mining/internal/types"
+	"github.com/carloszimm/github-mining/internal/util"
+)
+
+// source of the versions inferred from import statements
+const IMPORTS_SOURCE = "imports"
+
+// package names of each distribution in the manifests of its ecosystem
+var distributionPackages = map[string][]string{
+	"rxjava":  {"io.reactivex.rxjava3:rxjava", "io.reactivex.rxjava2:rxjava", "io.reactivex:rxjava"},
+	"rxjs":    {"rxjs", "@reactivex/rxjs", "rx", "rx-lite"},
+	"rxswift": {"RxSwift"},
+}
+
+// majors implied by the group of the RxJava artifacts (versions are often variables)
+var rxJavaGroupMajors = map[string]string{
+	"io.reactivex.rxjava3": "3",
+	"io.reactivex.rxjava2": "2",
+	"io.reactivex":         "1",
+}
+
+var (
+	majorReg = regexp.MustCompile(`\d+`)
+	// Gradle: 'group:rxjava:version' or "group:rxjava:$version"
+	gradleRxJavaReg = regexp.MustCompile(`(io\.reactivex(?:\.rxjava[23])?):rxjava:([^'"\s)]+)`)
+	// Maven: <groupId>group</groupId> <artifactId>rxjava</artifactId> [<version>version</version>]
+	mavenRxJavaReg = regexp.MustCompile(`<groupId>\s*(io\.reactivex(?:\.rxjava[23])?)\s*</groupId>\s*<artifactId>\s*rxjava\s*</artifactId>(?:\s*<version>\s*([^<\s]+)\s*</version>)?`)
+	// yarn.lock: rxjs@^6.5.4, "rxjs@~6.6.0": \n  version "6.6.7"
+	yarnLockReg = regexp.MustCompile(`(?m)^"?(@?[\w./-]+)@[^\n]*:\n(?:[ \t]+[^\n]*\n)*?[ \t]+version:?[ \t]+"?([^"\s]+)"?`)
+	// pnpm-lock.yaml: /rxjs/6.6.7: or /rxjs@7.8.1:
+	pnpmLockReg = regexp.MustCompile(`(?m)^[ \t]+'?/(@?[\w.-]+(?:/[\w.-]+)?)[/@](\d[^:('\s]*)`)
+	// Podfile.lock: - RxSwift (6.2.0), only the pods themselves (not their dependencies)
+	podfileLockReg = regexp.MustCompile(`(?m)^  -[ \t]+"?(\w+)[ \t]+\(([^)]+)\)`)
+	// Podfile: pod 'RxSwift', '~> 6.0'
+	podfileReg = regexp.MustCompile(`(?m)^[ \t]*pod[ \t]+['"](\w+)['"](?:[ \t]*,[ \t]*['"]([^'"]+)['"])?`)
+	// Cartfile(.resolved): github "ReactiveX/RxSwift" "6.2.0" or ~> 6.0
+	cartfileReg = regexp.MustCompile(`(?m)^[ \t]*github[ \t]+"[\w.-]+/(\w+)(?:\.git)?"[ \t]+(?:"([^"]+)"|([~>=<]+[ \t]*[\d.]+))`)
+	// Package.swift: .package(url: ".../RxSwift.git", from: "6.0.0") / .upToNextMajor(from: "6.0.0") / exact: "6.0.0"
+	packageSwiftReg = regexp.MustCompile(`\.package\s*\([^)]*?/(\w+?)(?:\.git)?"[^)]*?(?:from|exact|upToNextMajor\(from|upToNextMinor\(from)\s*:\s*"([^"]+)"`)
+)
+
+// returns the version parsed from a manifest or lockfile, if the file is one of them
+func parseManifest(filePath, content, dist string) []types.RxVersion {
+	packages := distributionPackages[strings.ToLower(dist)]
+	isDistPackage := func(name string) bool {
+		for _, pkg := range packages {
+			if strings.EqualFold(name, pkg) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var versions []types.RxVersion
+	add := func(version, major string) {
+		if major == "" {
+			major = majorReg.FindString(version)
+		}
+		versions = append(versions, types.RxVersion{Version: version, Major: major, Source: filePath})
+	}
+
+	switch name := path.Base(filePath); {
+	case name == "package.json":
+		var manifest map[string]json.RawMessage
+		if json.Unmarshal([]byte(content), &manifest) != nil {
+			return nil
+		}
+		for _, field := range []string{"dependencies", "devDependencies", "peerDependencies", "optionalDependencies"} {
+			var deps map[string]string
+			if json.Unmarshal(manifest[field], &deps) != nil {
+				continue
+			}
+			for pkg, version := range deps {
+				if isDistPackage(pkg) {
+					add(version, "")
+				}
+			}
+		}
+	case name == "package-lock.json" || name == "npm-shrinkwrap.json":
+		var lock struct {
+			Dependencies map[string]struct {
+				Version string `json:"version"`
+			} `json:"dependencies"`
+			Packages map[string]struct {
+				Version string `json:"version"`
+			} `json:"packages"`
+		}
+		if json.Unmarshal([]byte(content), &lock) != nil {
+			return nil
+		}
+		// only top level packages, the others are dependencies of dependencies
+		for pkg, dep := range lock.Packages {
+			if strings.Count(pkg, "node_modules/") == 1 && isDistPackage(strings.TrimPrefix(pkg, "node_modules/")) {
+				add(dep.Version, "")
+			}
+		}
+		if len(versions) == 0 {
+			for pkg, dep := range lock.Dependencies {
+				if isDistPackage(pkg) {
+					add(dep.Version, "")
+				}
+			}
+		}
+	case name == "yarn.lock":
+		for _, m := range yarnLockReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1]) {
+				add(m[2], "")
+			}
+		}
+	case name == "pnpm-lock.yaml":
+		for _, m := range pnpmLockReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1]) {
+				add(m[2], "")
+			}
+		}
+	case name == "build.gradle" || name == "build.gradle.kts":
+		for _, m := range gradleRxJavaReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1] + ":rxjava") {
+				add(m[2], rxJavaGroupMajors[m[1]])
+			}
+		}
+	case name == "pom.xml":
+		for _, m := range mavenRxJavaReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1] + ":rxjava") {
+				add(m[2], rxJavaGroupMajors[m[1]])
+			}
+		}
+	case name == "Podfile.lock":
+		for _, m := range podfileLockReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1]) {
+				add(m[2], "")
+			}
+		}
+	case name == "Podfile":
+		for _, m := range podfileReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1]) {
+				add(m[2], "")
+			}
+		}
+	case name == "Cartfile" || name == "Cartfile.resolved":
+		for _, m := range cartfileReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1]) {
+				add(m[2]+m[3], "")
+			}
+		}
+	case name == "Package.swift":
+		for _, m := range packageSwiftReg.FindAllStringSubmatch(content, -1) {
+			if isDistPackage(m[1]) {
+				add(m[2], "")
+			}
+		}
+	case name == "Package.resolved":
+		var resolved struct {
+			Object struct {
+				Pins []resolvedPin `json:"pins"`
+			} `json:"object"`
+			Pins []resolvedPin `json:"pins"`
+		}
+		if json.Unmarshal([]byte(content), &resolved) != nil {
+			return nil
+		}
+		for _, pin := range append(resolved.Object.Pins, resolved.Pins...) {
+			if isDistPackage(pin.Package) || isDistPackage(pin.Identity) {
+				add(pin.State.Version, "")
+			}
+		}
+	}
+	return versions
+}
+
+// Package.resolved pin (v1 uses package, v2 identity)
+type resolvedPin struct {
+	Package  string `json:"package"`
+	Identity string `json:"identity"`
+	State    struct {
+		Version string `json:"version"`
+	} `json:"state"`
+}
+
+// reports whether a file may be a manifest or lockfile read by parseManifest
+func isManifest(filePath string) bool {
+	switch path.Base(filePath) {
+	case "package.json", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml",
+		"build.gradle", "build.gradle.kts", "pom.xml",
+		"Podfile", "Podfile.lock", "Cartfile", "Cartfile.resolved", "Package.swift", "Package.resolved":
+		return true
+	}
+	return false
+}
+
+// returns the majors implied by the imported modules
+// rx. -> RxJava 1, io.reactivex. -> RxJava 2, io.reactivex.rxjava3. -> RxJava 3
+// rxjs/Rx, rxjs/Observable, rxjs/add/..., rxjs/observable/..., rxjs/operator/... -> RxJS 5
+func importedMajors(imports []types.Import, dist string) []string {
+	majors := make(map[string]struct{})
+	for _, imp := range imports {
+		switch strings.ToLower(dist) {
+		case "rxjava":
+			switch {
+			case imp.Module == "io.reactivex.rxjava3" || strings.HasPrefix(imp.Module, "io.reactivex.rxjava3."):
+				majors["3"] = struct{}{}
+			case imp.Module == "io.reactivex" || strings.HasPrefix(imp.Module, "io.reactivex."):
+				majors["2"] = struct{}{}
+			case imp.Module == "rx" || strings.HasPrefix(imp.Module, "rx."):
+				majors["1"] = struct{}{}
+			}
+		case "rxjs":
+			if imp.Module == "rxjs/Rx" || imp.Module == "rxjs/Observable" ||
+				strings.HasPrefix(imp.Module, "rxjs/add/") || strings.HasPrefix(imp.Module, "rxjs/observable/") ||
+				strings.HasPrefix(imp.Module, "rxjs/operator/") {
+				majors["5"] = struct{}{}
+			}
+		}
+	}
+	var result []string
+	for major := range majors {
+		result = append(result, major)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// type to store the Rx versions detected in each archive
+type VersionsReport struct {
+	mu       sync.Mutex
+	Archives map[string][]types.RxVersion
+}
+
+func NewVersionsReport() *VersionsReport {
+	return &VersionsReport{Archives: make(map[string][]types.RxVersion)}
+}
+
+func (vr *VersionsReport) Add(archive string, versions ...types.RxVersion) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	vr.Archives[archive] = mergeVersions(vr.Archives[archive], versions...)
+}
+
+func (vr *VersionsReport) Archive(archive string) []types.RxVersion {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	return append([]types.RxVersion(nil), vr.Archives[archive]...)
+}
+
+func (vr *VersionsReport) Remove(archive string) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	delete(vr.Archives, archive)
+}
+
+func (vr *VersionsReport) Write(path string) error {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	return util.WritePrettyJSON(path, vr.Archives)
+}
+
+// adds versions not yet present, keeping them sorted by source and version
+func mergeVersions(versions []types.RxVersion, toAdd ...types.RxVersion) []types.RxVersion {
+	for _, v := range toAdd {
+		found := false
+		for _, existing := range versions {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].Source != versions[j].Source {
+			return versions[i].Source < versions[j].Source
+		}
+		return versions[i].Version < versions[j].Version
+	})
+	return versions
+}
+
+// detects the Rx versions of a repository tarball(.tar.gz) from its manifests,
+// lockfiles and the imports of its source files
+func DetectArchiveVersions(r io.Reader, dist string) ([]types.RxVersion, error) {
+	archive, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	var versions []types.RxVersion
+	isDistModule := DistributionModuleMatcher(dist)
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		filePath := repoPath(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || inVendorDir(filePath) {
+			continue
+		}
+		manifest := isManifest(filePath)
+		if !manifest && importSyntax(filePath) == "" {
+			continue
+		}
+		bs, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if manifest {
+			versions = mergeVersions(versions, parseManifest(filePath, string(bs), dist)...)
+		} else if imports := distributionImports(ParseImports(filePath, string(bs)), isDistModule); len(imports) > 0 {
+			for _, major := range importedMajors(imports, dist) {
+				versions = mergeVersions(versions, types.RxVersion{Major: major, Source: IMPORTS_SOURCE})
+			}
+		}
+	}
+	return versions, nil
+}
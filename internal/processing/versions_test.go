@@ -0,0 +1,66 @@
+package processing
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/carloszimm/github-mining/internal/types"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name, file, dist, content string
+		want                      []types.RxVersion
+	}{
+		{"package.json", "a/package.json", "RxJS",
+			`{"dependencies": {"rxjs": "^7.5.0", "react": "18"}, "devDependencies": {"rx": "~4.1.0"}}`,
+			[]types.RxVersion{{Version: "^7.5.0", Major: "7"}, {Version: "~4.1.0", Major: "4"}}},
+		{"invalid package.json", "package.json", "RxJS", `{"dependencies": `, nil},
+		{"package-lock top level only", "package-lock.json", "RxJS",
+			`{"packages": {"": {}, "node_modules/rxjs": {"version": "7.8.1"}, "node_modules/a/node_modules/rxjs": {"version": "6.0.0"}}}`,
+			[]types.RxVersion{{Version: "7.8.1", Major: "7"}}},
+		{"package-lock v1", "package-lock.json", "RxJS", `{"dependencies": {"rxjs": {"version": "6.6.7"}}}`,
+			[]types.RxVersion{{Version: "6.6.7", Major: "6"}}},
+		{"yarn.lock", "yarn.lock", "RxJS",
+			"\"rxjs@^6.5.0\", \"rxjs@^6.6.0\":\n  version \"6.6.7\"\n  resolved \"https://x\"\n\nrxjs-compat@^6.0.0:\n  version \"6.0.0\"\n",
+			[]types.RxVersion{{Version: "6.6.7", Major: "6"}}},
+		{"pnpm-lock.yaml", "pnpm-lock.yaml", "RxJS", "packages:\n  /rxjs/7.8.0:\n    resolution: {}\n  /tslib/2.0.0:\n",
+			[]types.RxVersion{{Version: "7.8.0", Major: "7"}}},
+		{"gradle", "app/build.gradle", "RxJava",
+			"implementation 'io.reactivex.rxjava2:rxjava:$rxVersion'\nimplementation \"io.reactivex.rxjava3:rxjava:3.1.5\"\n",
+			[]types.RxVersion{{Version: "$rxVersion", Major: "2"}, {Version: "3.1.5", Major: "3"}}},
+		{"pom.xml", "pom.xml", "RxJava",
+			"<dependency>\n  <groupId>io.reactivex</groupId>\n  <artifactId>rxjava</artifactId>\n  <version>1.3.8</version>\n</dependency>",
+			[]types.RxVersion{{Version: "1.3.8", Major: "1"}}},
+		{"other distribution", "package.json", "RxJava", `{"dependencies": {"rxjs": "7.0.0"}}`, nil},
+		{"Podfile", "Podfile", "RxSwift", "target 'App' do\n  pod 'RxSwift', '~> 6.5'\n  pod 'RxCocoa'\nend\n",
+			[]types.RxVersion{{Version: "~> 6.5", Major: "6"}}},
+		{"Podfile.lock", "Podfile.lock", "RxSwift", "PODS:\n  - RxCocoa (6.5.0):\n    - RxSwift (= 6.5.0)\n  - RxSwift (6.5.0)\n",
+			[]types.RxVersion{{Version: "6.5.0", Major: "6"}}},
+		{"Cartfile", "Cartfile", "RxSwift", "github \"ReactiveX/RxSwift\" ~> 5.0\n",
+			[]types.RxVersion{{Version: "~> 5.0", Major: "5"}}},
+		{"Cartfile.resolved", "Cartfile.resolved", "RxSwift", "github \"ReactiveX/RxSwift\" \"6.2.0\"\n",
+			[]types.RxVersion{{Version: "6.2.0", Major: "6"}}},
+		{"Package.swift", "Package.swift", "RxSwift",
+			`.package(url: "https://github.com/ReactiveX/RxSwift.git", from: "6.0.0"),`,
+			[]types.RxVersion{{Version: "6.0.0", Major: "6"}}},
+		{"Package.resolved v2", "x.xcodeproj/Package.resolved", "RxSwift",
+			`{"pins": [{"identity": "rxswift", "state": {"version": "6.6.0"}}]}`,
+			[]types.RxVersion{{Version: "6.6.0", Major: "6"}}},
+		{"not a manifest", "src/package.ts", "RxJS", `{"dependencies": {"rxjs": "7"}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseManifest(tt.file, tt.content, tt.dist)
+			// map iteration makes the order of package.json entries random
+			sort.Slice(got, func(i, j int) bool { return got[i].Version < got[j].Version })
+			for i := range tt.want {
+				tt.want[i].Source = tt.file
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseManifest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package progress
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+)
+
+// interval between redraws of the terminal display
+const DISPLAY_INTERVAL = 500 * time.Millisecond
+
+// interval between progress log lines when the output isn't a terminal
+const LOG_INTERVAL = 30 * time.Second
+
+// API quota of a token for one of the GitHub resources (core, search, graphql)
+type Quota struct {
+	Remaining int
+	Limit     int
+	Reset     time.Time
+}
+
+// collects the progress and metrics of a long-running command
+// all methods can be called on a nil Tracker, doing nothing
+type Tracker struct {
+	command string
+	// what is counted as done (archives, repositories, queries)
+	unit  string
+	start time.Time
+	total int64
+	done  int64
+	files int64
+
+	mu     sync.Mutex
+	queues []queue
+	stages []stage
+	// token -> resource -> quota
+	quotas map[string]map[string]Quota
+}
+
+type queue struct {
+	stage  string
+	length func() int
+}
+
+// counters of a pipeline stage
+type StageStats struct {
+	Stage   string
+	Workers int
+	// items received and emitted
+	In, Out int64
+	Errors  int64
+	// time spent by the workers on the items
+	Busy time.Duration
+}
+
+type stage struct {
+	name  string
+	stats func() StageStats
+}
+
+func NewTracker(command, unit string) *Tracker {
+	return &Tracker{command: command, unit: unit, start: time.Now(),
+		quotas: make(map[string]map[string]Quota)}
+}
+
+// sets the number of items expected to be done (0 if unknown)
+func (t *Tracker) SetTotal(total int) {
+	if t != nil {
+		atomic.StoreInt64(&t.total, int64(total))
+	}
+}
+
+func (t *Tracker) AddDone(n int) {
+	if t != nil {
+		atomic.AddInt64(&t.done, int64(n))
+	}
+}
+
+func (t *Tracker) AddFiles(n int) {
+	if t != nil {
+		atomic.AddInt64(&t.files, int64(n))
+	}
+}
+
+// reports the depth of the queue feeding a stage
+func (t *Tracker) AddQueue(stage string, length func() int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queues = append(t.queues, queue{stage, length})
+}
+
+// reports the counters of a pipeline stage
+func (t *Tracker) AddStage(name string, stats func() StageStats) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages = append(t.stages, stage{name, stats})
+}
+
+// updates the quota of a token from the rate limit headers of a GitHub response
+// tokens are identified by a label (e.g. the worker id), never by their value
+func (t *Tracker) UpdateQuota(token string, resp *github.Response) {
+	if t == nil || resp == nil || resp.Rate.Limit == 0 {
+		return
+	}
+	resource := strings.ToLower(resp.Header.Get("X-RateLimit-Resource"))
+	if resource == "" {
+		resource = "core"
+	}
+	t.SetQuota(token, resource, Quota{Remaining: resp.Rate.Remaining, Limit: resp.Rate.Limit,
+		Reset: resp.Rate.Reset.Time})
+}
+
+func (t *Tracker) SetQuota(token, resource string, quota Quota) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.quotas[token]; !ok {
+		t.quotas[token] = make(map[string]Quota)
+	}
+	t.quotas[token][resource] = quota
+}
+
+// point-in-time copy of the tracker's metrics
+type Snapshot struct {
+	Command, Unit string
+	Elapsed       time.Duration
+	Total, Done   int64
+	Files         int64
+	FilesPerSec   float64
+	// stage -> depth, in the order the stages were added
+	Stages []string
+	Queues map[string]int
+	// counters of the pipeline stages, in the order they were added
+	Pipeline []StageStats
+	Quotas   map[string]map[string]Quota
+	// estimated time left; negative if unknown
+	ETA time.Duration
+}
+
+func (t *Tracker) Snapshot() *Snapshot {
+	s := &Snapshot{Command: t.command, Unit: t.unit, Elapsed: time.Since(t.start),
+		Total: atomic.LoadInt64(&t.total), Done: atomic.LoadInt64(&t.done),
+		Files: atomic.LoadInt64(&t.files), Queues: make(map[string]int),
+		Quotas: make(map[string]map[string]Quota), ETA: -1}
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		s.FilesPerSec = float64(s.Files) / secs
+	}
+	if s.Total > 0 && s.Done > 0 {
+		left := s.Total - s.Done
+		if left < 0 {
+			left = 0
+		}
+		s.ETA = time.Duration(float64(s.Elapsed) / float64(s.Done) * float64(left))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, q := range t.queues {
+		if _, ok := s.Queues[q.stage]; !ok {
+			s.Stages = append(s.Stages, q.stage)
+		}
+		s.Queues[q.stage] += q.length()
+	}
+	for _, stage := range t.stages {
+		stats := stage.stats()
+		stats.Stage = stage.name
+		s.Pipeline = append(s.Pipeline, stats)
+	}
+	for token, resources := range t.quotas {
+		s.Quotas[token] = make(map[string]Quota)
+		for resource, quota := range resources {
+			s.Quotas[token][resource] = quota
+		}
+	}
+	return s
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]map[string]Quota:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]Quota:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// one line summary of the progress
+func (s *Snapshot) String() string {
+	var b strings.Builder
+	if s.Total > 0 {
+		fmt.Fprintf(&b, "%s %d/%d (%.1f%%)", s.Unit, s.Done, s.Total, 100*float64(s.Done)/float64(s.Total))
+	} else {
+		fmt.Fprintf(&b, "%s %d", s.Unit, s.Done)
+	}
+	if s.Files > 0 {
+		fmt.Fprintf(&b, " | files %d (%.1f/s)", s.Files, s.FilesPerSec)
+	}
+	if len(s.Stages) > 0 {
+		b.WriteString(" | queues")
+		for _, stage := range s.Stages {
+			fmt.Fprintf(&b, " %s=%d", stage, s.Queues[stage])
+		}
+	}
+	for _, token := range sortedKeys(s.Quotas) {
+		fmt.Fprintf(&b, " | %s", token)
+		for _, resource := range sortedKeys(s.Quotas[token]) {
+			quota := s.Quotas[token][resource]
+			fmt.Fprintf(&b, " %s %d/%d", resource, quota.Remaining, quota.Limit)
+		}
+	}
+	fmt.Fprintf(&b, " | elapsed %s", s.Elapsed.Round(time.Second))
+	if s.ETA >= 0 {
+		fmt.Fprintf(&b, " | ETA %s", s.ETA.Round(time.Second))
+	}
+	return b.String()
+}
+
+// output of the log while the progress is redrawn on a terminal: the status line is
+// cleared before each log line and redrawn after it, so that they don't garble each other
+type statusWriter struct {
+	mu       sync.Mutex
+	terminal io.Writer
+	// output of the log before the display started
+	log    io.Writer
+	status string
+}
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == "" {
+		return s.log.Write(p)
+	}
+	fmt.Fprint(s.terminal, "\r\033[K")
+	n, err := s.log.Write(p)
+	fmt.Fprint(s.terminal, s.status)
+	return n, err
+}
+
+// redraws the status line; the final one ends it, leaving the terminal to the log
+func (s *statusWriter) draw(status string, final bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// \033[K clears what is left of a longer previous line
+	fmt.Fprintf(s.terminal, "\r%s\033[K", status)
+	s.status = status
+	if final {
+		fmt.Fprintln(s.terminal)
+		s.status = ""
+	}
+}
+
+// shows the progress until the returned function is called: redrawn in place
+// on terminals, logged periodically otherwise
+func (t *Tracker) Display(w *os.File) (stop func()) {
+	if t == nil {
+		return func() {}
+	}
+	interval := LOG_INTERVAL
+	terminal := isTerminal(w)
+	var status *statusWriter
+	if terminal {
+		interval = DISPLAY_INTERVAL
+		status = &statusWriter{terminal: w, log: log.Writer()}
+		log.SetOutput(status)
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if terminal {
+					status.draw(t.Snapshot().String(), false)
+				} else {
+					log.Printf("Progress: %s", t.Snapshot())
+				}
+			case <-done:
+				if terminal {
+					status.draw(t.Snapshot().String(), true)
+					log.SetOutput(status.log)
+				}
+				close(finished)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// serves the metrics in the Prometheus text format at http://addr/metrics
+// addresses without a host (e.g. ":9100") are bound to localhost only
+func (t *Tracker) Serve(addr string) {
+	if t == nil {
+		return
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		t.Snapshot().WritePrometheus(w)
+	})
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Metrics endpoint stopped: %v", err)
+		}
+	}()
+	log.Printf("Metrics available at http://%s/metrics", addr)
+}
+
+// writes the metrics in the Prometheus text exposition format
+func (s *Snapshot) WritePrometheus(w io.Writer) {
+	labels := fmt.Sprintf(`command=%q,unit=%q`, s.Command, s.Unit)
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP ghmining_%s %s\n# TYPE ghmining_%s %s\n", name, help, name, kind)
+	}
+
+	metric("items_done_total", "counter", "Items (archives, repositories, queries) done.")
+	fmt.Fprintf(w, "ghmining_items_done_total{%s} %d\n", labels, s.Done)
+	metric("items", "gauge", "Items expected to be done (0 if unknown).")
+	fmt.Fprintf(w, "ghmining_items{%s} %d\n", labels, s.Total)
+	metric("files_processed_total", "counter", "Files processed.")
+	fmt.Fprintf(w, "ghmining_files_processed_total{%s} %d\n", labels, s.Files)
+	metric("files_per_second", "gauge", "Average files processed per second.")
+	fmt.Fprintf(w, "ghmining_files_per_second{%s} %g\n", labels, s.FilesPerSec)
+	metric("elapsed_seconds", "gauge", "Seconds since the command started.")
+	fmt.Fprintf(w, "ghmining_elapsed_seconds{%s} %g\n", labels, s.Elapsed.Seconds())
+	if s.ETA >= 0 {
+		metric("eta_seconds", "gauge", "Estimated seconds left.")
+		fmt.Fprintf(w, "ghmining_eta_seconds{%s} %g\n", labels, s.ETA.Seconds())
+	}
+
+	if len(s.Stages) > 0 {
+		metric("queue_depth", "gauge", "Messages waiting to be consumed by a pipeline stage.")
+		for _, stage := range s.Stages {
+			fmt.Fprintf(w, "ghmining_queue_depth{%s,stage=%q} %d\n", labels, stage, s.Queues[stage])
+		}
+	}
+
+	if len(s.Pipeline) > 0 {
+		stageMetric := func(name, kind, help string, value func(StageStats) interface{}) {
+			metric(name, kind, help)
+			for _, stats := range s.Pipeline {
+				fmt.Fprintf(w, "ghmining_%s{%s,stage=%q} %v\n", name, labels, stats.Stage, value(stats))
+			}
+		}
+		stageMetric("stage_workers", "gauge", "Workers of a pipeline stage.",
+			func(stats StageStats) interface{} { return stats.Workers })
+		stageMetric("stage_items_in_total", "counter", "Items received by a pipeline stage.",
+			func(stats StageStats) interface{} { return stats.In })
+		stageMetric("stage_items_out_total", "counter", "Items emitted by a pipeline stage.",
+			func(stats StageStats) interface{} { return stats.Out })
+		stageMetric("stage_errors_total", "counter", "Errors returned by a pipeline stage.",
+			func(stats StageStats) interface{} { return stats.Errors })
+		stageMetric("stage_busy_seconds_total", "counter", "Seconds the workers of a pipeline stage spent on items.",
+			func(stats StageStats) interface{} { return stats.Busy.Seconds() })
+	}
+
+	if len(s.Quotas) > 0 {
+		metric("api_quota_remaining", "gauge", "GitHub API requests left for a token.")
+		for _, token := range sortedKeys(s.Quotas) {
+			for _, resource := range sortedKeys(s.Quotas[token]) {
+				fmt.Fprintf(w, "ghmining_api_quota_remaining{%s,token=%q,resource=%q} %d\n",
+					labels, token, resource, s.Quotas[token][resource].Remaining)
+			}
+		}
+		metric("api_quota_limit", "gauge", "GitHub API requests allowed per window for a token.")
+		for _, token := range sortedKeys(s.Quotas) {
+			for _, resource := range sortedKeys(s.Quotas[token]) {
+				fmt.Fprintf(w, "ghmining_api_quota_limit{%s,token=%q,resource=%q} %d\n",
+					labels, token, resource, s.Quotas[token][resource].Limit)
+			}
+		}
+		metric("api_quota_reset_timestamp_seconds", "gauge", "Unix time when the quota of a token is reset.")
+		for _, token := range sortedKeys(s.Quotas) {
+			for _, resource := range sortedKeys(s.Quotas[token]) {
+				fmt.Fprintf(w, "ghmining_api_quota_reset_timestamp_seconds{%s,token=%q,resource=%q} %d\n",
+					labels, token, resource, s.Quotas[token][resource].Reset.Unix())
+			}
+		}
+	}
+}
+
+// options shared by the commands to control the progress display and the metrics endpoint
+type Options struct {
+	Display     bool
+	MetricsAddr string
+}
+
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Display, "progress", true,
+		"indicates if the progress should be shown (redrawn on terminals, logged otherwise)")
+	fs.StringVar(&o.MetricsAddr, "metrics", "",
+		"address (e.g. :9100) where the metrics are served in the Prometheus text format at /metrics")
+}
+
+// starts the display and the metrics endpoint as set in the options;
+// the returned function stops the display
+func (t *Tracker) Start(o *Options) (stop func()) {
+	if o.MetricsAddr != "" {
+		t.Serve(o.MetricsAddr)
+	}
+	if o.Display {
+		return t.Display(os.Stderr)
+	}
+	return func() {}
+}
@@ -0,0 +1,23 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStatusWriter(t *testing.T) {
+	var out bytes.Buffer
+	s := &statusWriter{terminal: &out, log: &out}
+
+	s.Write([]byte("before\n"))
+	s.draw("1/2", false)
+	s.Write([]byte("during\n"))
+	s.draw("2/2", false)
+	s.draw("2/2", true)
+	s.Write([]byte("after\n"))
+
+	want := "before\n" + "\r1/2\033[K" + "\r\033[Kduring\n1/2" + "\r2/2\033[K" + "\r2/2\033[K\n" + "after\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
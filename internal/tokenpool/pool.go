@@ -0,0 +1,379 @@
+package tokenpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carloszimm/github-mining/internal/auth"
+	"github.com/google/go-github/v41/github"
+	"golang.org/x/oauth2"
+)
+
+// resources of the GitHub API with their own quotas
+const (
+	CORE    = "core"
+	SEARCH  = "search"
+	GRAPHQL = "graphql"
+)
+
+// label of the token used for requests without authentication
+const UNAUTHENTICATED = "unauthenticated"
+
+// wait applied on secondary rate limits without a Retry-After and on quotas exhausted
+// without a known reset
+const DEFAULT_RETRY_AFTER = time.Minute
+
+// waits between the attempts of a request failing for other reasons than rate limits:
+// RETRY_BACKOFF doubled on each attempt, up to MAX_RETRY_BACKOFF
+const (
+	RETRY_BACKOFF     = time.Second
+	MAX_RETRY_BACKOFF = time.Minute
+)
+
+// quotas per hour (per minute for search) assumed until a response tells the actual ones
+var (
+	defaultLimits = map[string]int{CORE: 5000, SEARCH: 30, GRAPHQL: 5000}
+	// GraphQL requires authentication
+	unauthenticatedLimits = map[string]int{CORE: 60, SEARCH: 10, GRAPHQL: 0}
+)
+
+type quota struct {
+	remaining, limit int
+	// zero while unknown
+	reset time.Time
+	// requests sent and not answered yet
+	inFlight int
+}
+
+// token of the pool with its own client and quotas
+type Token struct {
+	// identifies the token in logs and metrics, never its value
+	Label  string
+	Client *github.Client
+	quotas map[string]*quota
+	// set by secondary rate limits, for all resources
+	blockedUntil time.Time
+}
+
+// budget left for the resource at now
+func (t *Token) available(resource string, now time.Time) int {
+	if now.Before(t.blockedUntil) {
+		return 0
+	}
+	q := t.quotas[resource]
+	remaining := q.remaining
+	if !q.reset.IsZero() && now.After(q.reset) {
+		// quota renewed since the last response
+		remaining = q.limit
+	}
+	return remaining - q.inFlight
+}
+
+// when the token will have budget again for the resource (zero if unknown)
+func (t *Token) availableAt(resource string) time.Time {
+	at := t.quotas[resource].reset
+	if t.blockedUntil.After(at) {
+		at = t.blockedUntil
+	}
+	return at
+}
+
+// pool of tokens shared by all the workers of a command: each request goes to the token
+// with the most budget left for its resource, waiting only when every token is exhausted
+type Pool struct {
+	mu     sync.Mutex
+	tokens []*Token
+	// closed (and replaced) whenever quotas change, waking up the waiting requests
+	changed chan struct{}
+	// called with every response (optional), e.g. to report the quotas
+	OnResponse func(label string, resp *github.Response)
+}
+
+// creates a pool with a client per credential plus an unauthenticated client when requested
+func New(credentials []auth.Credential, unauthenticated bool) *Pool {
+	p := &Pool{changed: make(chan struct{})}
+	for _, credential := range credentials {
+		p.Add(credential.Label, github.NewClient(oauth2.NewClient(context.Background(), credential.Source)), defaultLimits)
+	}
+	if unauthenticated {
+		p.Add(UNAUTHENTICATED, github.NewClient(nil), unauthenticatedLimits)
+	}
+	return p
+}
+
+// adds a client to the pool with the quotas assumed until its first responses
+func (p *Pool) Add(label string, client *github.Client, limits map[string]int) *Token {
+	t := &Token{Label: label, Client: client, quotas: make(map[string]*quota)}
+	for _, resource := range []string{CORE, SEARCH, GRAPHQL} {
+		t.quotas[resource] = &quota{remaining: limits[resource], limit: limits[resource]}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokens = append(p.tokens, t)
+	return t
+}
+
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.tokens)
+}
+
+// scopes granted along with the ones given
+var impliedScopes = map[string][]string{
+	"repo":      {"public_repo", "repo:status", "repo_deployment", "repo:invite", "security_events"},
+	"admin:org": {"write:org", "read:org"},
+	"write:org": {"read:org"},
+	"user":      {"read:user", "user:email", "user:follow"},
+}
+
+// checks that every authenticated token of the pool is valid and has the given OAuth scopes,
+// seeding their quotas; tokens not reporting scopes (fine-grained and installation tokens)
+// are only checked for validity
+func (p *Pool) Validate(ctx context.Context, scopes []string) error {
+	p.mu.Lock()
+	tokens := append([]*Token{}, p.tokens...)
+	p.mu.Unlock()
+
+	var problems []string
+	for _, t := range tokens {
+		if t.Label == UNAUTHENTICATED {
+			continue
+		}
+		limits, resp, err := t.Client.RateLimits(ctx)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+				problems = append(problems, fmt.Sprintf("%s is invalid or expired", t.Label))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s: %v", t.Label, err))
+			}
+			continue
+		}
+		if header, ok := resp.Header[http.CanonicalHeaderKey("X-OAuth-Scopes")]; ok {
+			if missing := missingScopes(strings.Join(header, ","), scopes); len(missing) > 0 {
+				problems = append(problems, fmt.Sprintf("%s lacks the scope(s) %s", t.Label, strings.Join(missing, ", ")))
+			}
+		}
+
+		p.mu.Lock()
+		// go-github doesn't report the GraphQL quota, left to the first GraphQL response
+		for resource, rate := range map[string]*github.Rate{CORE: limits.GetCore(), SEARCH: limits.GetSearch()} {
+			if rate != nil {
+				q := t.quotas[resource]
+				q.remaining, q.limit, q.reset = rate.Remaining, rate.Limit, rate.Reset.Time
+			}
+		}
+		p.mu.Unlock()
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid GitHub credentials: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// scopes not granted by the X-OAuth-Scopes header
+func missingScopes(header string, scopes []string) []string {
+	granted := make(map[string]bool)
+	for _, scope := range strings.Split(header, ",") {
+		scope = strings.TrimSpace(scope)
+		granted[scope] = true
+		for _, implied := range impliedScopes[scope] {
+			granted[implied] = true
+		}
+	}
+	var missing []string
+	for _, scope := range scopes {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// runs the request fn with the token with the most budget for the resource, retrying it
+// (possibly with another token) while it is rate limited
+func (p *Pool) Do(ctx context.Context, resource string, fn func(client *github.Client) (*github.Response, error)) error {
+	for {
+		t, err := p.acquire(ctx, resource)
+		if err != nil {
+			return err
+		}
+		resp, err := fn(t.Client)
+		if !p.release(t, resource, resp, err) {
+			return err
+		}
+	}
+}
+
+// reserves a request of the resource on the token with the most budget, waiting for one
+func (p *Pool) acquire(ctx context.Context, resource string) (*Token, error) {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		var best *Token
+		var wakeUp time.Time
+		eligible := 0
+		for _, t := range p.tokens {
+			if t.quotas[resource].limit == 0 {
+				// resource not available to the token at all (e.g. GraphQL without authentication)
+				continue
+			}
+			eligible++
+			if available := t.available(resource, now); available > 0 {
+				if best == nil || available > best.available(resource, now) {
+					best = t
+				}
+			} else {
+				at := t.availableAt(resource)
+				if q := t.quotas[resource]; !at.After(now) && q.inFlight == 0 {
+					// no reset known nor response to come that could renew the quota,
+					// so it's assumed renewed after a while
+					at = now.Add(DEFAULT_RETRY_AFTER)
+					q.reset = at
+				}
+				if at.After(now) && (wakeUp.IsZero() || at.Before(wakeUp)) {
+					wakeUp = at
+				}
+			}
+		}
+		if eligible == 0 {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("no GitHub token in the pool can access the %s API", resource)
+		}
+		if best != nil {
+			q := best.quotas[resource]
+			if !q.reset.IsZero() && now.After(q.reset) {
+				q.remaining, q.reset = q.limit, time.Time{}
+			}
+			q.inFlight++
+			p.mu.Unlock()
+			return best, nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		var timer <-chan time.Time
+		if !wakeUp.IsZero() {
+			d := time.Until(wakeUp)
+			log.Printf("All tokens exhausted for %s, waiting %.1f minute(s)", resource, d.Minutes())
+			timer = time.After(d + time.Second)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		case <-timer:
+		}
+	}
+}
+
+// updates the quotas of the token from the response, returning if the request was
+// rate limited and must be retried
+func (p *Pool) release(t *Token, resource string, resp *github.Response, err error) bool {
+	if p.OnResponse != nil && resp != nil {
+		p.OnResponse(t.Label, resp)
+	}
+
+	p.mu.Lock()
+	defer func() {
+		close(p.changed)
+		p.changed = make(chan struct{})
+		p.mu.Unlock()
+	}()
+	q := t.quotas[resource]
+	q.inFlight--
+
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		q.remaining, q.reset = 0, rateErr.Rate.Reset.Time
+		if rateErr.Rate.Limit > 0 {
+			q.limit = rateErr.Rate.Limit
+		}
+		log.Printf("%s exhausted its %s quota until %s", t.Label, resource, q.reset.Format(time.Kitchen))
+		return true
+	case errors.As(err, &abuseErr):
+		wait := DEFAULT_RETRY_AFTER
+		if abuseErr.RetryAfter != nil {
+			wait = *abuseErr.RetryAfter
+		}
+		t.blockedUntil = time.Now().Add(wait)
+		log.Printf("%s hit a secondary rate limit, retrying after %s", t.Label, wait)
+		return true
+	}
+
+	if resp == nil {
+		return false
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		if wait, ok := retryAfter(resp.Header); ok {
+			t.blockedUntil = time.Now().Add(wait)
+			log.Printf("%s was asked to retry after %s", t.Label, wait)
+			return true
+		}
+	}
+	if resp.Rate.Limit > 0 {
+		if r := strings.ToLower(resp.Header.Get("X-RateLimit-Resource")); r != "" {
+			if _, ok := t.quotas[r]; ok {
+				q = t.quotas[r]
+			}
+		}
+		q.remaining, q.limit, q.reset = resp.Rate.Remaining, resp.Rate.Limit, resp.Rate.Reset.Time
+	}
+	return false
+}
+
+// waits before retrying a request after its attempt-th failure (from 1), returning the
+// context's error if it's cancelled meanwhile
+func Backoff(ctx context.Context, attempt int) error {
+	wait := MAX_RETRY_BACKOFF
+	if attempt < 16 {
+		if backoff := RETRY_BACKOFF << (attempt - 1); backoff < wait {
+			wait = backoff
+		}
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reports whether GitHub rejected the request with a client error other than a rate
+// limit (those are waited for by Do), e.g. for a deleted repository, so retrying it is pointless
+func Rejected(err error) bool {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+	status := errResp.Response.StatusCode
+	return status >= http.StatusBadRequest && status < http.StatusInternalServerError &&
+		status != http.StatusTooManyRequests
+}
+
+// parses the Retry-After header given in seconds
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		if at, err := http.ParseTime(value); err == nil {
+			return time.Until(at), true
+		}
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
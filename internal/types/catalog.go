@@ -0,0 +1,128 @@
+package types
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// operators catalog of a distribution (files under assets/operators)
+// besides this format, catalogs can still be plain arrays of operators' names
+type Catalog struct {
+	// name of the catalog file it was loaded from
+	File         string            `json:"file"`
+	Distribution string            `json:"distribution"`
+	Version      string            `json:"version"`
+	Operators    []CatalogOperator `json:"operators"`
+}
+
+type CatalogOperator struct {
+	// canonical name; counts of the aliases are folded into it
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	// versions of the distribution that introduced and deprecated the operator
+	Introduced string `json:"introduced,omitempty"`
+	Deprecated string `json:"deprecated,omitempty"`
+	// static (creation, e.g. Observable.just) or instance (e.g. .map)
+	Kind     string `json:"kind,omitempty"`
+	Category string `json:"category,omitempty"`
+	// overrides of how the operator is matched (optional), see OperatorPattern
+	Patterns []OperatorPattern `json:"patterns,omitempty"`
+}
+
+// pattern overriding the default rule used to match an operator (its name, not preceded by
+// a word character, followed by ( or {) in files of the given languages
+// in the regular expressions (regexp2 syntax), {name} stands for the operator name (or alias),
+// with its metacharacters quoted, and marks the position reported for the match
+type OperatorPattern struct {
+	// entries of Programming_Languages_Extensions.json; the pattern applies to all languages if empty
+	// patterns for a specific language take precedence over the ones for all languages
+	Languages []string `json:"languages,omitempty"`
+	// replaces the default rule, e.g. `(?<!\w){name}\s+\w` for Kotlin infix calls
+	Match string `json:"match,omitempty"`
+	// expressions expected before the dot preceding the operator, e.g. `Observable` or `\.rx`;
+	// uses without one of them are discarded
+	Receivers []string `json:"receivers,omitempty"`
+	// negative patterns: uses also matched by one of them are discarded,
+	// e.g. `\]\s*\.\s*{name}` for methods of array literals
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+const (
+	STATIC_KIND   = "static"
+	INSTANCE_KIND = "instance"
+)
+
+var catalogVersionReg = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// parses a catalog in either the rich format or as a plain array of operators' names
+// for plain arrays, the version is taken from the file name (e.g. "rxjava 3.1.1.json")
+func ParseCatalog(fileName, dist string, data []byte) (*Catalog, error) {
+	catalog := &Catalog{File: fileName}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err == nil {
+		catalog.Distribution = dist
+		catalog.Version = catalogVersionReg.FindString(fileName)
+		for _, name := range names {
+			catalog.Operators = append(catalog.Operators, CatalogOperator{Name: name})
+		}
+		return catalog, nil
+	}
+
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, err
+	}
+	catalog.File = fileName
+	if catalog.Distribution == "" {
+		catalog.Distribution = dist
+	}
+	return catalog, nil
+}
+
+// returns the canonical operators' names
+func (c *Catalog) Names() []string {
+	names := make([]string, len(c.Operators))
+	for i, op := range c.Operators {
+		names[i] = op.Name
+	}
+	return names
+}
+
+// returns the names to be searched (canonical names and aliases) and,
+// for each of them, the index of its canonical operator
+func (c *Catalog) Patterns() ([]string, []int) {
+	var patterns []string
+	var canonical []int
+	seen := make(map[string]int)
+	for i, op := range c.Operators {
+		for _, name := range append([]string{op.Name}, op.Aliases...) {
+			name = strings.TrimSpace(name)
+			if j, ok := seen[name]; ok {
+				if c.Operators[j].Name == op.Name {
+					log.Printf("%s is listed more than once in %s, counting it once", name, c.File)
+				} else {
+					log.Printf("%s is listed for both %s and %s in %s, keeping the first one",
+						name, c.Operators[j].Name, op.Name, c.File)
+				}
+				continue
+			}
+			seen[name] = i
+			patterns = append(patterns, name)
+			canonical = append(canonical, i)
+		}
+	}
+	return patterns, canonical
+}
+
+// returns the operators deprecated in the catalog
+func (c *Catalog) Deprecated() []string {
+	var deprecated []string
+	for _, op := range c.Operators {
+		if op.Deprecated != "" {
+			deprecated = append(deprecated, op.Name)
+		}
+	}
+	return deprecated
+}
@@ -0,0 +1,115 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCatalog(t *testing.T) {
+	tests := []struct {
+		name, file, data string
+		want             *Catalog
+	}{
+		{"plain array", "rxjava 3.1.1.json", `["map", "flatMap"]`,
+			&Catalog{File: "rxjava 3.1.1.json", Distribution: "RxJava", Version: "3.1.1",
+				Operators: []CatalogOperator{{Name: "map"}, {Name: "flatMap"}}}},
+		{"plain array without version", "rxjava.json", `[]`,
+			&Catalog{File: "rxjava.json", Distribution: "RxJava"}},
+		{"rich format", "custom.json",
+			`{"version": "7.3.0", "operators": [{"name": "catchError", "aliases": ["catch"], "introduced": "5.5.0", "kind": "instance"}]}`,
+			&Catalog{File: "custom.json", Distribution: "RxJava", Version: "7.3.0",
+				Operators: []CatalogOperator{{Name: "catchError", Aliases: []string{"catch"}, Introduced: "5.5.0", Kind: INSTANCE_KIND}}}},
+		{"distribution of the catalog", "custom.json", `{"distribution": "RxJS", "version": "7"}`,
+			&Catalog{File: "custom.json", Distribution: "RxJS", Version: "7"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCatalog(tt.file, "RxJava", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCatalog = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ParseCatalog("broken.json", "RxJava", []byte(`{"operators": [`)); err == nil {
+		t.Error("ParseCatalog of invalid JSON succeeded")
+	}
+}
+
+func TestCatalogPatterns(t *testing.T) {
+	catalog := &Catalog{File: "custom.json", Operators: []CatalogOperator{
+		{Name: "catchError", Aliases: []string{"catch", " catch "}},
+		{Name: "flatMap", Aliases: []string{"mergeMap"}, Deprecated: "8.0.0"},
+		// alias of another operator, kept for the first one
+		{Name: "mergeMap", Aliases: []string{"catch"}},
+		{Name: "do", Deprecated: "5.5.0"},
+	}}
+	patterns, canonical := catalog.Patterns()
+	if want := []string{"catchError", "catch", "flatMap", "mergeMap", "do"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("patterns = %v, want %v", patterns, want)
+	}
+	if want := []int{0, 0, 1, 1, 3}; !reflect.DeepEqual(canonical, want) {
+		t.Errorf("canonical = %v, want %v", canonical, want)
+	}
+	if want := []string{"flatMap", "do"}; !reflect.DeepEqual(catalog.Deprecated(), want) {
+		t.Errorf("Deprecated = %v, want %v", catalog.Deprecated(), want)
+	}
+}
+
+// every catalog shipped under assets/operators has to load, patterns included
+func TestShippedCatalogs(t *testing.T) {
+	dir := filepath.Join("..", "..", "assets", "operators")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops, err := NewOperators(entry.Name(), "", data)
+		if err != nil {
+			t.Errorf("%s: %v", entry.Name(), err)
+			continue
+		}
+		if len(ops.GetOperators()) == 0 {
+			t.Errorf("%s has no operators", entry.Name())
+		}
+	}
+}
+
+// aliases of the shipped catalogs are folded, try/catch blocks aren't taken for catch
+func TestShippedCatalogAliases(t *testing.T) {
+	tests := []struct {
+		file, dist, language, content string
+		want                          map[string]int
+	}{
+		{"rxjs 7.3.0.json", "RxJS", "JavaScript",
+			"try { obs.catch(f) } catch (e) {}\nobs.pipe(catchError(g), pluck('a'))",
+			map[string]int{"catchError": 2, "pluck": 1}},
+		{"RxSwift.json", "RxSwift", "Swift",
+			"do { try f() } catch { }\nobs.catch { _ in fallback }.catchError { _ in fallback }.catchAndReturn(0)",
+			map[string]int{"catchError": 2, "catchErrorJustReturn": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "assets", "operators", tt.file))
+			if err != nil {
+				t.Skip(err)
+			}
+			ops, err := NewOperators(tt.file, tt.dist, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := &ContentMsg{Language: tt.language, FileContent: tt.content, Source: tt.content}
+			if got := totals(ops.Count(msg)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("totals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package types
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/carloszimm/github-mining/internal/util"
+	"github.com/dlclark/regexp2"
+	"github.com/dlclark/regexp2/syntax"
+)
+
+// single-pass matcher for a list of operators
+// an Aho-Corasick automaton finds every candidate operator name and each candidate
+// is then checked against the same rules as the per-operator regular expression:
+// not preceded by a word character and followed by optional spaces and ( or {
+type OpsMatcher struct {
+	operators []string
+	ac        *util.AhoCorasick
+}
+
+func NewOpsMatcher(operators []string) *OpsMatcher {
+	return &OpsMatcher{operators: operators, ac: util.NewAhoCorasick(operators)}
+}
+
+// returns the (byte) offsets of every call of each operator in s,
+// indexed as the list of operators given to the matcher
+func (m *OpsMatcher) Match(s string) [][]int {
+	offsets := make([][]int, len(m.operators))
+	m.ac.FindAll(s, func(op, start int) {
+		if isOperatorCall(s, start, start+len(m.operators[op])) {
+			offsets[op] = append(offsets[op], start)
+		}
+	})
+	return offsets
+}
+
+// returns the (byte) offsets of every call of name in s, checked as the operators' ones
+func matchName(s, name string) []int {
+	var offsets []int
+	for start := 0; start < len(s); {
+		i := strings.Index(s[start:], name)
+		if i < 0 {
+			break
+		}
+		if i += start; isOperatorCall(s, i, i+len(name)) {
+			offsets = append(offsets, i)
+		}
+		start = i + len(name)
+	}
+	return offsets
+}
+
+func isOperatorCall(s string, start, end int) bool {
+	// (?<!\w)
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:start])
+		if syntax.IsWordChar(r) {
+			return false
+		}
+	}
+	// \s*(\(|{)
+	for end < len(s) {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		switch {
+		case r == '(' || r == '{':
+			return true
+		case unicode.IsSpace(r):
+			end += size
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// (?<!\w) - negative look-behind to make sure the operator name isn't preceded by any character
+// besides its own name
+// \s* - followed by zero or more spaces
+// { - for swift closures
+// kept as the reference implementation for the single-pass matcher
+func createRegexp(opName string) *regexp2.Regexp {
+	return regexp2.MustCompile(`\.?(?<!\w)`+regexp2.Escape(opName)+`\s*(\(|{)`, 0)
+}
+
+// returns the (byte) offsets of the operator name matched by re in s
+func regexpMatch(re *regexp2.Regexp, s string) []int {
+	var indexes []int
+	for _, groups := range util.Regexp2FindAllString(re, s) {
+		index := groups[0].Index
+		// skips the optional dot
+		if groups[0].String()[0] == '.' {
+			index++
+		}
+		indexes = append(indexes, index)
+	}
+	// regexp2 works with runes, so rune indexes are converted back to bytes
+	return runesToBytes(s, indexes)
+}
@@ -0,0 +1,150 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `{"distribution": "RxJS", "version": "7.3.0", "operators": [
+	{"name": "map", "patterns": [{"languages": ["JavaScript"], "exclude": ["\\]\\s*\\.\\s*{name}"]}]},
+	{"name": "mapTo"},
+	{"name": "switchMap"},
+	{"name": "filter"},
+	{"name": "catchError", "aliases": ["catch"]},
+	{"name": "of", "patterns": [{"receivers": ["Observable", "Rx"]}]},
+	{"name": "zipWith", "patterns": [{"languages": ["Kotlin"], "match": "(?<!\\w){name}\\s+\\w"}, {"languages": ["Kotlin"]}]},
+	{"name": "subscribe"}
+]}`
+
+func testOperators(t testing.TB) *Operators {
+	ops, err := NewOperators("rxjs.json", "RxJS", []byte(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops.TrackOccurrences = true
+	return ops
+}
+
+func totals(counts []OperatorCount) map[string]int {
+	result := make(map[string]int)
+	for _, count := range counts {
+		if count.Total > 0 {
+			result[count.Operator] = count.Total
+		}
+	}
+	return result
+}
+
+func TestMatcherAgreesWithRegexp(t *testing.T) {
+	tests := []struct {
+		name, language, content string
+		want                    map[string]int
+	}{
+		{"dot chaining", "TypeScript", "obs.map(x => x).filter(Boolean).subscribe()",
+			map[string]int{"map": 1, "filter": 1, "subscribe": 1}},
+		{"pipeable", "TypeScript", "obs.pipe(map(f), switchMap (g), mapTo(1))",
+			map[string]int{"map": 1, "switchMap": 1, "mapTo": 1}},
+		{"closures", "Swift", "obs.map { $0 }.filter{ $0 > 1 }", map[string]int{"map": 1, "filter": 1}},
+		{"preceded by a word character", "TypeScript", "remap(x); mapper(y); flatmap(z)", map[string]int{}},
+		{"not a call", "TypeScript", "const map = new Map(); obs.map; obs.map.call", map[string]int{}},
+		{"alias folded", "JavaScript", "obs.catch(e => of(1)).catchError(f)", map[string]int{"catchError": 2}},
+		{"excluded by language", "JavaScript", "[1, 2].map(f); obs.map(g)", map[string]int{"map": 1}},
+		{"exclusion of another language", "TypeScript", "[1, 2].map(f); obs.map(g)", map[string]int{"map": 2}},
+		{"receivers", "JavaScript", "Observable.of(1); Rx.of(2); Array.of(3); of(4)", map[string]int{"of": 2}},
+		{"infix call", "Kotlin", "a zipWith b; a.zipWith(b)", map[string]int{"zipWith": 2}},
+		{"infix elsewhere", "Java", "a zipWith b; a.zipWith(b)", map[string]int{"zipWith": 1}},
+		{"multi-byte", "TypeScript", "const é = obs.map(ü => ü).filter(ß)", map[string]int{"map": 1, "filter": 1}},
+		{"empty", "TypeScript", "", map[string]int{}},
+	}
+	ops := testOperators(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &ContentMsg{FileName: "a.tar.gz", InnerFileName: "a/src/f", Language: tt.language,
+				FileContent: tt.content, Source: tt.content}
+			got, want := ops.Count(msg), ops.RegexpCount(msg)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Count = %+v, RegexpCount = %+v", got, want)
+			}
+			if !reflect.DeepEqual(totals(got), tt.want) {
+				t.Errorf("totals = %v, want %v", totals(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAliases(t *testing.T) {
+	ops := testOperators(t)
+	content := "obs.pipe(rxMap(f), rxCatch(g), other(h)); notrxMap(x)"
+	offsets := ops.Match(content, "TypeScript")
+	ops.MatchAliases(content, map[string]string{"rxMap": "map", "rxCatch": "catch", "other": "unknown"}, offsets)
+	got := totals(ops.CountOffsets(&ContentMsg{FileContent: content, Source: content}, offsets))
+	if want := map[string]int{"map": 1, "catchError": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("totals = %v, want %v", got, want)
+	}
+}
+
+func TestOccurrencesMapOffsetsToSource(t *testing.T) {
+	source := "// c\nobs.map(f)\n  .filter(g)"
+	msg := &ContentMsg{FileName: "a.tar.gz", InnerFileName: "a/f.js", Source: source}
+	// the comment dropped and a space inserted after "obs.map(f)"
+	om := &OffsetMap{}
+	om.Copy(0, 5)
+	msg.FileContent = source[5:15] + " " + source[15:]
+	om.Copy(11, 15)
+	msg.AddOffsetMap(om)
+
+	got := msg.Occurrences("filter", []int{strings.Index(msg.FileContent, "filter")})
+	if len(got) != 1 || got[0].Line != 3 || got[0].Column != 4 || got[0].Snippet != ".filter(g)" {
+		t.Errorf("Occurrences = %+v, want line 3, column 4", got)
+	}
+}
+
+// content of a file using operators every few lines, sized like a typical source file
+func benchmarkContent() string {
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		b.WriteString("const result = source.pipe(\n  map(x => x * 2),\n  filter(x => x > 10),\n")
+		b.WriteString("  switchMap(x => of(x)),\n  catchError(err => of(null))\n);\n")
+		b.WriteString("function helper(value) { return value.toString().split(',').join(';'); }\n")
+	}
+	return b.String()
+}
+
+func benchmarkOperators(b *testing.B) *Operators {
+	data, err := os.ReadFile(filepath.Join("..", "..", "assets", "operators", "rxjs 7.3.0.json"))
+	if err != nil {
+		b.Skip(err)
+	}
+	ops, err := NewOperators("rxjs 7.3.0.json", "RxJS", data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return ops
+}
+
+func BenchmarkCount(b *testing.B) {
+	ops := benchmarkOperators(b)
+	content := benchmarkContent()
+	msg := &ContentMsg{Language: "TypeScript", FileContent: content, Source: content}
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ops.Count(msg)
+	}
+}
+
+func BenchmarkRegexpCount(b *testing.B) {
+	ops := benchmarkOperators(b)
+	content := benchmarkContent()
+	msg := &ContentMsg{Language: "TypeScript", FileContent: content, Source: content}
+	// compiles the regular expressions before timing
+	ops.RegexpCount(&ContentMsg{})
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ops.RegexpCount(msg)
+	}
+}
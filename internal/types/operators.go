@@ -1,13 +1,17 @@
 package types
 
 import (
-	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/carloszimm/github-mining/internal/config"
-	"github.com/carloszimm/github-mining/internal/util"
 	"github.com/dlclark/regexp2"
 )
 
@@ -15,97 +19,343 @@ import (
 type ContentMsg struct {
 	FileName      string
 	InnerFileName string
-	FileContent   string
+	// path relative to the repository root (InnerFileName without the top folder of tarballs)
+	Path string
+	// language of the file (entry of Programming_Languages_Extensions.json)
+	Language    string
+	FileContent string
+	// original file content, kept untouched by the comments and strings removal
+	// so matches can be traced back to the source
+	Source string
+	// maps of the offsets of FileContent back to Source, one per removal
+	offsetMaps []*OffsetMap
+	// import statements found in the file (filled in by the import check)
+	Imports []Import
+	// whether the file is test, production or sample code
+	FileClass string
+	// distributions imported by the file (filled in by the import check)
+	Distributions []string
+	// distribution -> names the file gives to the symbols imported from it under another
+	// name -> symbol imported (filled in by the import check)
+	Aliases map[string]map[string]string
 }
 
-// type to store the repo name(FileName) and some operator counting
+// type to store a single import statement: the module/package imported and
+// the names (symbols) it brings into the file
+type Import struct {
+	Module  string
+	Symbols []string
+	// local name -> symbol, for the symbols imported under another name
+	// (e.g. `import { map as rxMap }` or Kotlin's `import a.b.map as rxMap`)
+	Aliases map[string]string
+	// syntax the statement was parsed with: jvm, js or swift
+	Syntax string
+}
+
+// returns the aliases of the symbols imported by the file from the imports accepted by keep
+func (msg *ContentMsg) ImportedAliases(keep func(imp Import) bool) map[string]string {
+	var aliases map[string]string
+	for _, imp := range msg.Imports {
+		if len(imp.Aliases) > 0 && (keep == nil || keep(imp)) {
+			if aliases == nil {
+				aliases = make(map[string]string)
+			}
+			for local, symbol := range imp.Aliases {
+				aliases[local] = symbol
+			}
+		}
+	}
+	return aliases
+}
+
+// type to store the repo name(FileName) and the operators counting of one of its files
+// one is sent per distribution imported by the file
 type CountMsg struct {
+	Distribution  string
 	FileName      string
 	InnerFileName string
-	OperatorCount
+	FileClass     string
+	Language      string
+	Counts        []OperatorCount
+	// sequences of operators composed together (only filled in when chains are extracted)
+	Chains [][]string
+}
+
+// type sent after the last file of an archive (FileName) with the number of files sent
+// for it, so the end of the pipeline knows when the archive is finished
+type ArchiveDoneMsg struct {
+	FileName string
+	Files    int
+	// error that interrupted the reading of the archive, if any
+	Err error
+}
+
+// type sent in place of a file dropped by a pipeline stage
+type FileSkippedMsg struct {
+	FileName string
+}
+
+// message of the operators pipeline; only one of its fields is set: the content of a
+// file, its counts (one per distribution imported), a skipped file or the end of an archive
+type FileMsg struct {
+	Content *ContentMsg
+	Counts  []CountMsg
+	Skipped *FileSkippedMsg
+	Done    *ArchiveDoneMsg
 }
 
 type OperatorCount struct {
 	Operator string
 	Total    int
+	// only filled in when occurrences are tracked
+	Occurrences []Occurrence
+}
+
+// type to store a single operator match traced back to the original source
+type Occurrence struct {
+	Distribution string `json:"distribution,omitempty"`
+	Archive      string `json:"archive"`
+	File         string `json:"file"`
+	Language     string `json:"language,omitempty"`
+	Line         int    `json:"line"`
+	Column       int    `json:"column"`
+	Operator     string `json:"operator"`
+	Snippet      string `json:"snippet"`
+}
+
+// max number of characters kept in an occurrence's snippet
+const SNIPPET_LENGTH = 160
+
+// map of the (byte) offsets of a text back to the ones of the text it was derived from,
+// made of segments copied from it in order, with text dropped or inserted between them
+type OffsetMap struct {
+	// start of each segment in the derived text and in the original one
+	starts, sources []int
+}
+
+// adds a segment copied from source in the original text to start in the derived one
+func (om *OffsetMap) Copy(start, source int) {
+	if n := len(om.starts); n > 0 && start-om.starts[n-1] == source-om.sources[n-1] {
+		// continues the last segment
+		return
+	}
+	om.starts = append(om.starts, start)
+	om.sources = append(om.sources, source)
 }
 
-// type used to hold operators' names and generate workers per request
+// returns the offset in the original text of an offset in a segment of the derived one
+func (om *OffsetMap) Source(offset int) int {
+	i := sort.SearchInts(om.starts, offset+1) - 1
+	if i < 0 {
+		return offset
+	}
+	return om.sources[i] + offset - om.starts[i]
+}
+
+// records that FileContent was derived from its previous content as told by om
+func (msg *ContentMsg) AddOffsetMap(om *OffsetMap) {
+	msg.offsetMaps = append(msg.offsetMaps, om)
+}
+
+// returns the offset in Source of an offset in FileContent
+func (msg *ContentMsg) SourceOffset(offset int) int {
+	for i := len(msg.offsetMaps) - 1; i >= 0; i-- {
+		offset = msg.offsetMaps[i].Source(offset)
+	}
+	return offset
+}
+
+// converts (byte) offsets of the operator in FileContent into occurrences
+// line and column are 1-based; column is counted in runes
+func (msg *ContentMsg) Occurrences(opName string, offsets []int) []Occurrence {
+	if len(offsets) == 0 {
+		return nil
+	}
+	source := msg.Source
+	occurrences := make([]Occurrence, 0, len(offsets))
+	line, lineStart, pos := 1, 0, 0
+	for _, offset := range offsets {
+		// the maps are monotonic, so offsets stay sorted
+		if offset = msg.SourceOffset(offset); offset > len(source) {
+			offset = len(source)
+		}
+		for ; pos < offset && pos < len(source); pos++ {
+			if source[pos] == '\n' {
+				line++
+				lineStart = pos + 1
+			}
+		}
+		lineEnd := strings.IndexByte(source[lineStart:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(source)
+		} else {
+			lineEnd += lineStart
+		}
+		occurrences = append(occurrences, Occurrence{
+			Archive: msg.FileName, File: msg.InnerFileName, Language: msg.Language,
+			Line: line, Column: utf8.RuneCountInString(source[lineStart:offset]) + 1, Operator: opName,
+			Snippet: snippet(source[lineStart:lineEnd]),
+		})
+	}
+	return occurrences
+}
+
+func snippet(line string) string {
+	s := strings.TrimSpace(line)
+	if r := []rune(s); len(r) > SNIPPET_LENGTH {
+		s = string(r[:SNIPPET_LENGTH]) + "..."
+	}
+	return s
+}
+
+// type used to hold operators' names and count them per file
 type Operators struct {
 	Dist          string
+	Catalog       *Catalog
 	operatorsList []string
+	// names searched (operators and their aliases) and their canonical operator
+	patterns   []string
+	patternOps []int
+	matcher    *OpsMatcher
+	// per-operator patterns of the catalog, indexed as patterns
+	overrides map[int][]*namePattern
+	// regular expressions of the reference counters, compiled on first use
+	regexpsOnce sync.Once
+	regexps     []*regexp2.Regexp
+	// indicates if counters should also report where each match happened
+	TrackOccurrences bool
 }
 
 func (ops *Operators) GetOperators() []string {
 	return ops.operatorsList
 }
 
-func (ops *Operators) CreateWorkerOps() ([]chan ContentMsg, <-chan interface{}) {
-	inChannels := make([]chan ContentMsg, len(ops.operatorsList))
-	outChannels := make([]<-chan interface{}, 0, len(ops.operatorsList)*config.PROCESSING_WORKERS)
+// returns the (byte) offsets of every call of each operator in a text of the given language,
+// indexed as GetOperators and with the aliases already folded
+// operators with patterns in the catalog are matched by them instead of the default rule
+func (ops *Operators) Match(s, lang string) [][]int {
+	return ops.fold(applyOverrides(ops.overrides, s, lang, ops.matcher.Match(s)))
+}
 
-	// ranges through the operators list and creates a channel/worker for each operator
-	// stores output channels for futher merging and creation of a single channel
-	for i, op := range ops.operatorsList {
-		inChannel := make(chan ContentMsg)
-		inChannels[i] = inChannel
-		counterFn := createCounter(op)
-		for j := 0; j < config.PROCESSING_WORKERS; j++ {
-			outChannels = append(outChannels, createOpWorker(inChannel, op, counterFn))
+// adds to offsets (as returned by Match) the calls of the operators the file imports under
+// another name, aliases mapping these names to the imported ones (see ImportedAliases)
+func (ops *Operators) MatchAliases(s string, aliases map[string]string, offsets [][]int) {
+	for local, symbol := range aliases {
+		if local == symbol || local == "" {
+			continue
+		}
+		for i, pattern := range ops.patterns {
+			if pattern != symbol {
+				continue
+			}
+			if matches := matchName(s, local); len(matches) > 0 {
+				op := ops.patternOps[i]
+				offsets[op] = append(offsets[op], matches...)
+				sort.Ints(offsets[op])
+			}
+			break
 		}
 	}
+}
 
-	return inChannels, util.MergeChannels(outChannels...)
+// counts all operators of a file in a single pass
+func (ops *Operators) Count(msg *ContentMsg) []OperatorCount {
+	return ops.CountOffsets(msg, ops.Match(msg.FileContent, msg.Language))
 }
 
-func createOpWorker(in <-chan ContentMsg, opName string, counterFn func(string) int) <-chan interface{} {
-	// give it some buffer in case previous pipeline steps run too quickly
-	out := make(chan interface{}, config.PROCESSING_WORKERS)
-	go func() {
-		for msg := range in {
-			out <- CountMsg{msg.FileName, msg.InnerFileName,
-				OperatorCount{opName, counterFn(msg.FileContent)}}
+// counts all operators of a file with one regular expression per operator
+// it is the reference implementation that the single-pass matcher must agree with
+func (ops *Operators) RegexpCount(msg *ContentMsg) []OperatorCount {
+	ops.regexpsOnce.Do(func() {
+		for _, pattern := range ops.patterns {
+			ops.regexps = append(ops.regexps, createRegexp(pattern))
 		}
-		close(out)
-	}()
-	return out
+	})
+	offsets := make([][]int, len(ops.regexps))
+	for i, re := range ops.regexps {
+		offsets[i] = regexpMatch(re, msg.FileContent)
+	}
+	return ops.CountOffsets(msg, ops.fold(applyOverrides(ops.overrides, msg.FileContent, msg.Language, offsets)))
 }
 
-func CreateOperators(path string, dist string) *Operators {
-	data, err := ioutil.ReadFile(filepath.Join(config.OPERATORS_PATH, path))
-	util.CheckError(err)
-
-	ops := Operators{Dist: dist}
+// folds the offsets found for each pattern into their canonical operators
+func (ops *Operators) fold(patternOffsets [][]int) [][]int {
+	offsets := make([][]int, len(ops.operatorsList))
+	for i, patternOffset := range patternOffsets {
+		op := ops.patternOps[i]
+		if offsets[op] != nil && patternOffset != nil {
+			offsets[op] = append(offsets[op], patternOffset...)
+			sort.Ints(offsets[op])
+		} else if patternOffset != nil {
+			offsets[op] = patternOffset
+		}
+	}
+	return offsets
+}
 
-	err = json.Unmarshal(data, &ops.operatorsList)
-	util.CheckError(err)
+// counts the offsets returned by Match
+func (ops *Operators) CountOffsets(msg *ContentMsg, offsets [][]int) []OperatorCount {
+	counts := make([]OperatorCount, len(ops.operatorsList))
+	for i, op := range ops.operatorsList {
+		counts[i] = OperatorCount{Operator: op, Total: len(offsets[i])}
+		if ops.TrackOccurrences {
+			counts[i].Occurrences = msg.Occurrences(op, offsets[i])
+			for j := range counts[i].Occurrences {
+				counts[i].Occurrences[j].Distribution = ops.Dist
+			}
+		}
+	}
+	return counts
+}
 
-	return &ops
+func CreateOperators(path string, dist string) (*Operators, error) {
+	data, err := ioutil.ReadFile(filepath.Join(config.OPERATORS_PATH, path))
+	if err != nil {
+		return nil, fmt.Errorf("reading the operators catalog: %w", err)
+	}
+	return NewOperators(path, dist, data)
 }
 
-// (?<!\w) - negative look-behind to make sure the operator name isn't preceded by any character
-// besides its own name
-// \s* - followed by zero or more spaces
-// { - for swift closures
-func createCounter(opName string) func(string) int {
-	re := regexp2.MustCompile(`\.?(?<!\w)`+opName+`\s*(\(|{)`, 0)
-	return func(s string) int {
-		return len(util.Regexp2FindAllString(re, s))
+// creates the operators of a catalog given its file name and content
+func NewOperators(path string, dist string, data []byte) (*Operators, error) {
+	catalog, err := ParseCatalog(path, dist, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := &Operators{Dist: dist, Catalog: catalog, operatorsList: catalog.Names()}
+	ops.patterns, ops.patternOps = catalog.Patterns()
+	ops.matcher = NewOpsMatcher(ops.patterns)
+	ops.overrides, err = compileOverrides(catalog, ops.patterns, ops.patternOps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
+	return ops, nil
 }
 
-/* // alternative with stdlib
-func createCounter(opName string) func(string) int {
-	re := regexp.MustCompile(`\.?\W` + opName + `\s*(\(|{)`)
-	return func(s string) int {
-		return len(re.FindAllStringIndex(s, -1))
+// loads the operators of the given catalog file under OPERATORS_PATH or, if no
+// file is given, of the first file whose name contains the distribution
+func LoadOperators(dist, catalogFile string) (*Operators, error) {
+	if catalogFile != "" {
+		return CreateOperators(catalogFile, dist)
 	}
-} */
 
-func CloseAllInOps(inOps []chan ContentMsg) {
-	for _, in := range inOps {
-		close(in)
+	opDir, err := os.ReadDir(config.OPERATORS_PATH)
+	if err != nil {
+		return nil, fmt.Errorf("listing the operators catalogs: %w", err)
+	}
+
+	// (?i) case insensitive
+	reg, err := regexp.Compile("(?i)" + dist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid distribution %q: %w", dist, err)
+	}
+	for _, d := range opDir {
+		if !d.IsDir() && reg.MatchString(d.Name()) {
+			return CreateOperators(d.Name(), dist)
+		}
 	}
+	return nil, fmt.Errorf("no operators catalog found for %s", dist)
 }
 
 // sort operator count by operators' names
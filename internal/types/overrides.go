@@ -0,0 +1,197 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/carloszimm/github-mining/internal/util"
+	"github.com/dlclark/regexp2"
+)
+
+// placeholder of the operator name in the patterns of the catalogs
+const NAME_PLACEHOLDER = "{name}"
+
+// group marking the operator name in the compiled patterns
+const OP_GROUP = "op"
+
+// max number of bytes before an operator where its receiver is looked for
+const RECEIVER_WINDOW = 256
+
+// OperatorPattern compiled for one of the names of an operator
+type namePattern struct {
+	languages map[string]struct{}
+	// nil when the default rule is kept
+	match *regexp2.Regexp
+	// nil when any receiver (or none) is accepted
+	receivers *regexp2.Regexp
+	exclude   []*regexp2.Regexp
+}
+
+// compiles a pattern for the given name: the first {name} becomes the group
+// whose position is reported and the remaining ones just the quoted name
+func compileNamePattern(pattern, name string) (*regexp2.Regexp, error) {
+	if !strings.Contains(pattern, NAME_PLACEHOLDER) {
+		return nil, fmt.Errorf("pattern %q doesn't contain %s", pattern, NAME_PLACEHOLDER)
+	}
+	quoted := regexp2.Escape(name)
+	expr := strings.Replace(pattern, NAME_PLACEHOLDER, "(?<"+OP_GROUP+">"+quoted+")", 1)
+	expr = strings.ReplaceAll(expr, NAME_PLACEHOLDER, quoted)
+	re, err := regexp2.Compile(expr, 0)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %q of %s: %v", pattern, name, err)
+	}
+	return re, nil
+}
+
+func newNamePattern(p OperatorPattern, name string) (*namePattern, error) {
+	np := &namePattern{languages: make(map[string]struct{})}
+	for _, lang := range p.Languages {
+		np.languages[lang] = struct{}{}
+	}
+	var err error
+	if p.Match != "" {
+		if np.match, err = compileNamePattern(p.Match, name); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.Receivers) > 0 {
+		// the receiver ends right before the dot (or ?. and !!.) preceding the operator
+		expr := `(?:` + strings.Join(p.Receivers, "|") + `)\s*(?:\?|!!)?\.\s*\z`
+		if np.receivers, err = regexp2.Compile(expr, 0); err != nil {
+			return nil, fmt.Errorf("receivers %q of %s: %v", p.Receivers, name, err)
+		}
+	}
+	for _, exclude := range p.Exclude {
+		re, err := compileNamePattern(exclude, name)
+		if err != nil {
+			return nil, err
+		}
+		np.exclude = append(np.exclude, re)
+	}
+	return np, nil
+}
+
+// compiles the patterns of the catalog operators for each of the names searched,
+// returning them indexed as the names
+func compileOverrides(catalog *Catalog, names []string, nameOps []int) (map[int][]*namePattern, error) {
+	overrides := make(map[int][]*namePattern)
+	for i, name := range names {
+		for _, p := range catalog.Operators[nameOps[i]].Patterns {
+			np, err := newNamePattern(p, name)
+			if err != nil {
+				return nil, err
+			}
+			overrides[i] = append(overrides[i], np)
+		}
+	}
+	return overrides, nil
+}
+
+// returns the patterns that apply to a language: the ones listing it or, if
+// there is none, the ones for all languages
+func applicablePatterns(patterns []*namePattern, lang string) []*namePattern {
+	var specific, general []*namePattern
+	for _, np := range patterns {
+		if len(np.languages) == 0 {
+			general = append(general, np)
+		} else if _, ok := np.languages[lang]; ok {
+			specific = append(specific, np)
+		}
+	}
+	if len(specific) > 0 {
+		return specific
+	}
+	return general
+}
+
+// replaces the offsets found by the default rule for the names with overrides
+func applyOverrides(overrides map[int][]*namePattern, s, lang string, offsets [][]int) [][]int {
+	for i, patterns := range overrides {
+		applicable := applicablePatterns(patterns, lang)
+		if len(applicable) == 0 {
+			continue
+		}
+		found := make(map[int]struct{})
+		for _, np := range applicable {
+			for _, offset := range np.find(s, offsets[i]) {
+				found[offset] = struct{}{}
+			}
+		}
+		var result []int
+		for offset := range found {
+			result = append(result, offset)
+		}
+		sort.Ints(result)
+		offsets[i] = result
+	}
+	return offsets
+}
+
+// returns the offsets matched by the pattern; defaults are the ones found by the default rule
+func (np *namePattern) find(s string, defaults []int) []int {
+	candidates := defaults
+	if np.match != nil {
+		candidates = groupOffsets(np.match, s)
+	}
+	excluded := make(map[int]struct{})
+	for _, re := range np.exclude {
+		for _, offset := range groupOffsets(re, s) {
+			excluded[offset] = struct{}{}
+		}
+	}
+	var offsets []int
+	for _, offset := range candidates {
+		if _, ok := excluded[offset]; ok {
+			continue
+		}
+		if np.receivers != nil && !np.hasReceiver(s, offset) {
+			continue
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+func (np *namePattern) hasReceiver(s string, offset int) bool {
+	start := offset - RECEIVER_WINDOW
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	ok, _ := np.receivers.MatchString(s[start:offset])
+	return ok
+}
+
+// returns the (byte) offsets of the operator group of every match of re in s
+func groupOffsets(re *regexp2.Regexp, s string) []int {
+	var indexes []int
+	for _, groups := range util.Regexp2FindAllString(re, s) {
+		for _, group := range groups {
+			if group.Name == OP_GROUP {
+				indexes = append(indexes, group.Index)
+			}
+		}
+	}
+	return runesToBytes(s, indexes)
+}
+
+// converts ascending rune indexes of s (as used by regexp2) into byte offsets
+func runesToBytes(s string, indexes []int) []int {
+	if len(indexes) == 0 {
+		return nil
+	}
+	offsets := make([]int, 0, len(indexes))
+	byteOffset, runeOffset := 0, 0
+	for _, index := range indexes {
+		for ; runeOffset < index; runeOffset++ {
+			_, size := utf8.DecodeRuneInString(s[byteOffset:])
+			byteOffset += size
+		}
+		offsets = append(offsets, byteOffset)
+	}
+	return offsets
+}
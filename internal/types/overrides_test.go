@@ -0,0 +1,38 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		pattern, want string
+	}{
+		{`{"match": "\\bmap\\("}`, `doesn't contain {name}`},
+		{`{"match": "({name}"}`, "pattern"},
+		{`{"exclude": ["\\]\\s*\\."]}`, `doesn't contain {name}`},
+		{`{"receivers": ["(Observable"]}`, "receivers"},
+	}
+	for _, tt := range tests {
+		data := `{"operators": [{"name": "map", "patterns": [` + tt.pattern + `]}]}`
+		_, err := NewOperators("custom.json", "RxJS", []byte(data))
+		if err == nil || !strings.HasPrefix(err.Error(), "custom.json: ") || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewOperators with %s = %v, want an error with %q", tt.pattern, err, tt.want)
+		}
+	}
+}
+
+func TestCompileNamePattern(t *testing.T) {
+	// the name is quoted and only its first placeholder reports the position
+	re, err := compileNamePattern(`{name}\s*\(\s*{name}`, "a.b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// offsets are in bytes, although regexp2 reports runes
+	s := "é = a.b(a.b); y = axb(axb)"
+	if got, want := groupOffsets(re, s), []int{5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("offsets = %v, want %v", got, want)
+	}
+}
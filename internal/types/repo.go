@@ -8,6 +8,8 @@ type Info struct {
 	FileName           string `json:"fileName"`
 	FileSize           int    `json:"fileSize"`
 	ArchiveUrl         string `json:"url"`
+	// Rx versions detected in the archive
+	RxVersions []RxVersion `json:"rxVersions,omitempty"`
 }
 
 type InfoFile struct {
@@ -19,3 +21,14 @@ type InfoFile struct {
 	FileSize           int    `json:"-"`
 	ArchiveUrl         string `json:"-"`
 }
+
+// type to store a version of the Rx distribution used by a repository
+type RxVersion struct {
+	// version(or range) as declared, empty when inferred from the imports
+	Version string `json:"version,omitempty"`
+	Major   string `json:"major,omitempty"`
+	// manifest/lockfile path or "imports"
+	Source string `json:"source"`
+	// only filled in when several distributions are searched at once
+	Distribution string `json:"distribution,omitempty"`
+}
@@ -0,0 +1,76 @@
+package util
+
+// Aho-Corasick automaton used to find several patterns in a single pass over a text
+// based on https://cr.yp.to/bib/1975/aho.pdf, compiled into a byte-level DFA
+type AhoCorasick struct {
+	delta    [][256]int32
+	outputs  [][]int
+	patterns []string
+}
+
+func NewAhoCorasick(patterns []string) *AhoCorasick {
+	ac := &AhoCorasick{patterns: patterns}
+	ac.newState()
+
+	// builds the trie; missing transitions are -1 until the failure links are computed
+	for i, pattern := range patterns {
+		state := int32(0)
+		for j := 0; j < len(pattern); j++ {
+			next := ac.delta[state][pattern[j]]
+			if next < 0 {
+				next = ac.newState()
+				ac.delta[state][pattern[j]] = next
+			}
+			state = next
+		}
+		ac.outputs[state] = append(ac.outputs[state], i)
+	}
+
+	// computes the failure links breadth-first and turns them into direct transitions
+	fail := make([]int32, len(ac.delta))
+	queue := make([]int32, 0, len(ac.delta))
+	for c := 0; c < 256; c++ {
+		if next := ac.delta[0][c]; next < 0 {
+			ac.delta[0][c] = 0
+		} else {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		// a state also outputs the patterns of its longest proper suffix
+		ac.outputs[state] = append(ac.outputs[state], ac.outputs[fail[state]]...)
+		for c := 0; c < 256; c++ {
+			if next := ac.delta[state][c]; next < 0 {
+				ac.delta[state][c] = ac.delta[fail[state]][c]
+			} else {
+				fail[next] = ac.delta[fail[state]][c]
+				queue = append(queue, next)
+			}
+		}
+	}
+	return ac
+}
+
+func (ac *AhoCorasick) newState() int32 {
+	var transitions [256]int32
+	for c := range transitions {
+		transitions[c] = -1
+	}
+	ac.delta = append(ac.delta, transitions)
+	ac.outputs = append(ac.outputs, nil)
+	return int32(len(ac.delta) - 1)
+}
+
+// calls fn with the pattern index and the start (byte) offset of every match in s,
+// overlapping matches included, ordered by their end offset
+func (ac *AhoCorasick) FindAll(s string, fn func(pattern, start int)) {
+	state := int32(0)
+	for i := 0; i < len(s); i++ {
+		state = ac.delta[state][s[i]]
+		for _, pattern := range ac.outputs[state] {
+			fn(pattern, i+1-len(ac.patterns[pattern]))
+		}
+	}
+}
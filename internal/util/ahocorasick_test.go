@@ -0,0 +1,77 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type acMatch struct {
+	pattern, start int
+}
+
+// reference: every occurrence of every pattern, ordered by end offset and then by
+// length (longest first), as the automaton reports them
+func naiveFindAll(patterns []string, s string) []acMatch {
+	var matches []acMatch
+	for end := 1; end <= len(s); end++ {
+		for start := 0; start < end; start++ {
+			for i, p := range patterns {
+				if p == s[start:end] {
+					matches = append(matches, acMatch{i, start})
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func findAll(ac *AhoCorasick, s string) []acMatch {
+	var matches []acMatch
+	ac.FindAll(s, func(pattern, start int) {
+		matches = append(matches, acMatch{pattern, start})
+	})
+	return matches
+}
+
+func TestAhoCorasickFindAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		text     string
+		want     []acMatch
+	}{
+		{"no match", []string{"map"}, "filter(x)", nil},
+		{"single", []string{"map"}, "a.map(x)", []acMatch{{0, 2}}},
+		{"repeated", []string{"of"}, "of(of(1))", []acMatch{{0, 0}, {0, 3}}},
+		{"suffix pattern", []string{"flatMap", "Map"}, "flatMap(", []acMatch{{0, 0}, {1, 4}}},
+		{"prefix pattern", []string{"concat", "concatMap"}, "concatMap(", []acMatch{{0, 0}, {1, 0}}},
+		{"overlapping", []string{"aa"}, "aaaa", []acMatch{{0, 0}, {0, 1}, {0, 2}}},
+		{"failure link", []string{"abcd", "bce"}, "abce", []acMatch{{1, 1}}},
+		{"multi-byte", []string{"map"}, "é.map(ü)", []acMatch{{0, 3}}},
+		{"empty text", []string{"map"}, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findAll(NewAhoCorasick(tt.patterns), tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAll(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAhoCorasickAgreesWithNaiveSearch(t *testing.T) {
+	patterns := []string{"map", "mapTo", "switchMap", "Map", "a", "ap", "tap", "pipe", "pipeable"}
+	texts := []string{
+		"obs.pipe(map(x => x), switchMap(f), tap(g)).subscribe()",
+		"mapTomapTapmap switchMapTo pipeable",
+		strings.Repeat("ma", 50) + "p",
+	}
+	ac := NewAhoCorasick(patterns)
+	for _, text := range texts {
+		if got, want := findAll(ac, text), naiveFindAll(patterns, text); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAll(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// returns a context cancelled on SIGINT or SIGTERM, so the commands can stop their
+// workers and write partial results; a second signal terminates the process right away
+// stop releases the signal handling once the command is done
+func InterruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			// restores the default behavior, so a second signal exits right away
+			signal.Stop(signals)
+			log.Printf("Received %v: stopping and writing partial results (send it again to exit right away)", sig)
+			cancel()
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
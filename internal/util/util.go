@@ -2,6 +2,7 @@ package util
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -9,36 +10,35 @@ import (
 	"github.com/golang-module/carbon/v2"
 )
 
+// exits on error; the internal packages return their errors, so it's meant for the main functions
 func CheckError(err error) {
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func WriteJSON(path string, data interface{}) {
+func WriteJSON(path string, data interface{}) error {
 	j, err := json.Marshal(data)
-	CheckError(err)
-
-	err = os.WriteFile(path+".json", j, 0644)
-	CheckError(err)
+	if err != nil {
+		return fmt.Errorf("encoding %s.json: %w", path, err)
+	}
+	return os.WriteFile(path+".json", j, 0644)
 }
 
-func WritePrettyJSON(path string, data interface{}) {
+func WritePrettyJSON(path string, data interface{}) error {
 	j, err := json.MarshalIndent(data, "", "\t")
-	CheckError(err)
-
-	err = os.WriteFile(path+".json", j, 0644)
-	CheckError(err)
+	if err != nil {
+		return fmt.Errorf("encoding %s.json: %w", path, err)
+	}
+	return os.WriteFile(path+".json", j, 0644)
 }
 
-func WriteFolder(folderPath string) {
-	err := os.MkdirAll(folderPath, os.ModePerm)
-	CheckError(err)
+func WriteFolder(folderPath string) error {
+	return os.MkdirAll(folderPath, os.ModePerm)
 }
 
-func RemoveAllFolders(folderPath string) {
-	err := os.RemoveAll(folderPath)
-	CheckError(err)
+func RemoveAllFolders(folderPath string) error {
+	return os.RemoveAll(folderPath)
 }
 
 func NowDateTimeFormatted() string {